@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"order_service/infra/constant"
+	"order_service/infra/log"
+	"order_service/infra/utils"
+	"order_service/models"
+	"strconv"
+)
+
+func (h *OrderHandler) GetAddresses(c *gin.Context) {
+	userIdF, err := utils.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	addresses, err := h.OrderUseCase.GetUserAddresses(c.Request.Context(), int64(userIdF))
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"user_id": int64(userIdF),
+			"err":     err.Error(),
+		}).Error("failed to get addresses")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to get addresses",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": addresses,
+	})
+}
+
+func (h *OrderHandler) CreateAddress(c *gin.Context) {
+	userIdF, err := utils.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var req models.UserAddressRequest
+	if err = c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid request",
+		})
+		return
+	}
+
+	address, err := h.OrderUseCase.SaveUserAddress(c.Request.Context(), int64(userIdF), &req)
+	if err != nil {
+		logAddressError(err, int64(userIdF), 0, "failed to save address")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to save address",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": address,
+	})
+}
+
+func (h *OrderHandler) UpdateAddress(c *gin.Context) {
+	userIdF, err := utils.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	addressId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || addressId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid address id",
+		})
+		return
+	}
+
+	var req models.UserAddressRequest
+	if err = c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid request",
+		})
+		return
+	}
+
+	address, err := h.OrderUseCase.UpdateUserAddress(c.Request.Context(), int64(userIdF), addressId, &req)
+	if err != nil {
+		logAddressError(err, int64(userIdF), addressId, "failed to update address")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to update address",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": address,
+	})
+}
+
+func (h *OrderHandler) DeleteAddress(c *gin.Context) {
+	userIdF, err := utils.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	addressId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || addressId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid address id",
+		})
+		return
+	}
+
+	err = h.OrderUseCase.DeleteUserAddress(c.Request.Context(), int64(userIdF), addressId)
+	if err != nil {
+		logAddressError(err, int64(userIdF), addressId, "failed to delete address")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to delete address",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok": true,
+	})
+}
+
+// logAddressError log unexpected address book errors, client mistakes are only returned
+func logAddressError(err error, userID int64, addressID int64, message string) {
+	if errors.Is(err, constant.ErrInvalidAddress) || errors.Is(err, constant.ErrAddressNotFound) ||
+		errors.Is(err, constant.ErrAddressBookFull) || errors.Is(err, constant.ErrAddressConflict) {
+		return
+	}
+
+	log.Logger.WithFields(logrus.Fields{
+		"user_id":    userID,
+		"address_id": addressID,
+		"err":        err.Error(),
+	}).Error(message)
+}
@@ -1,14 +1,22 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"io"
 	"net/http"
 	"order_service/cmd/usecase"
+	"order_service/infra/constant"
 	"order_service/infra/log"
 	"order_service/infra/utils"
 	"order_service/models"
+	"order_service/money"
+	"order_service/product"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type OrderHandler struct {
@@ -46,9 +54,9 @@ func (h *OrderHandler) CheckOutOrder(c *gin.Context) {
 	}
 
 	param.UserID = int64(userId)
-	orderId, err := h.OrderUseCase.CheckOutOrder(c.Request.Context(), &param)
+	result, err := h.OrderUseCase.CheckOutOrder(c.Request.Context(), &param)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(errorStatusCode(err), gin.H{
 			"message": "failed to checkout order",
 			"err":     err.Error(),
 		})
@@ -60,9 +68,14 @@ func (h *OrderHandler) CheckOutOrder(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	if result.Replayed {
+		c.Header("Idempotent-Replayed", "true")
+	}
+
+	c.JSON(result.ResponseStatus, gin.H{
 		"ok":       true,
-		"order_id": orderId,
+		"order_id": result.OrderID,
+		"saga_id":  result.SagaID,
 	})
 
 }
@@ -77,20 +90,17 @@ func (h *OrderHandler) GetOrderHistory(c *gin.Context) {
 	}
 	userId := int64(userIdF)
 
-	statusStr := c.DefaultQuery("status", "0")
-	status, err := strconv.Atoi(statusStr)
-	if err != nil {
+	param := &models.OrderHistoryParam{
+		UserID: userId,
+	}
+
+	if err = parseOrderHistoryQuery(c, param); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "invalid status",
+			"message": err.Error(),
 		})
 		return
 	}
 
-	param := &models.OrderHistoryParam{
-		UserID: userId,
-		Status: status,
-	}
-
 	history, err := h.OrderUseCase.GetOrderHistoryByUserId(c.Request.Context(), param)
 	if err != nil {
 		log.Logger.WithFields(logrus.Fields{
@@ -105,6 +115,386 @@ func (h *OrderHandler) GetOrderHistory(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"data": history,
+		"data":        history.Orders,
+		"next_cursor": history.NextCursor,
 	})
 }
+
+// parseOrderHistoryQuery read the filter, sorting and pagination query params of the order history
+func parseOrderHistoryQuery(c *gin.Context, param *models.OrderHistoryParam) error {
+	statuses, err := parseStatusQuery(c.Query("status"))
+	if err != nil {
+		return err
+	}
+	param.Statuses = statuses
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, err := parseTimeQuery(fromStr, false)
+		if err != nil {
+			return errors.New("invalid from")
+		}
+		param.From = &from
+	}
+
+	if toStr := c.Query("to"); toStr != "" {
+		to, err := parseTimeQuery(toStr, true)
+		if err != nil {
+			return errors.New("invalid to")
+		}
+		param.To = &to
+	}
+
+	if param.From != nil && param.To != nil && !param.From.Before(*param.To) {
+		return errors.New("from must be before to")
+	}
+
+	if productIdStr := c.Query("product_id"); productIdStr != "" {
+		productId, err := strconv.ParseInt(productIdStr, 10, 64)
+		if err != nil || productId <= 0 {
+			return errors.New("invalid product_id")
+		}
+		param.ProductID = productId
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return errors.New("invalid limit")
+		}
+		param.Limit = limit
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		id, err := utils.DecodeCursor(cursor)
+		if err != nil {
+			return err
+		}
+		param.Cursor = id
+	}
+
+	param.Sort = strings.ToLower(c.DefaultQuery("sort", constant.SortDesc))
+	if param.Sort != constant.SortAsc && param.Sort != constant.SortDesc {
+		return errors.New("invalid sort")
+	}
+	return nil
+}
+
+// parseStatusQuery read a comma separated list of status names such as `created,processing`.
+// An empty value or `all` means no status filter. Numeric statuses are still accepted for older clients.
+func parseStatusQuery(value string) ([]int, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	if value == "" || value == constant.OrderStatusAll {
+		return nil, nil
+	}
+
+	var statuses []int
+	seen := map[int]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+
+		status, ok := constant.ParseOrderStatus(name)
+		if !ok {
+			number, err := strconv.Atoi(name)
+			if _, known := constant.OrderStatusTranslated[number]; err != nil || !known {
+				return nil, fmt.Errorf("invalid status %q, expected %s or a comma separated list of %s",
+					name, constant.OrderStatusAll, strings.Join(constant.OrderStatusNames, ", "))
+			}
+			status = number
+		}
+
+		if !seen[status] {
+			seen[status] = true
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+// parseTimeQuery accept RFC3339 timestamps or plain dates. A plain date used as the
+// upper bound covers the whole day, so `to=2025-01-31` includes orders made on the 31st.
+func parseTimeQuery(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func (h *OrderHandler) GetOrderDetail(c *gin.Context) {
+	userIdF, err := utils.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	orderId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || orderId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid order id",
+		})
+		return
+	}
+
+	orderDetail, err := h.OrderUseCase.GetOrderDetailByID(c.Request.Context(), orderId, int64(userIdF))
+	if err != nil {
+		if !errors.Is(err, constant.ErrOrderNotFound) {
+			log.Logger.WithFields(logrus.Fields{
+				"order_id": orderId,
+				"err":      err.Error(),
+			}).Error("failed to get order detail")
+		}
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to get order detail",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": orderDetail,
+	})
+}
+
+func (h *OrderHandler) GetCheckoutSaga(c *gin.Context) {
+	userIdF, err := utils.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	saga, err := h.OrderUseCase.GetCheckoutSaga(c.Request.Context(), c.Param("id"), int64(userIdF))
+	if err != nil {
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to get checkout saga",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": saga,
+	})
+}
+
+// CancelOrder let a customer cancel their order, a reason is required
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	userIdF, err := utils.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	orderId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || orderId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid order id",
+		})
+		return
+	}
+
+	var req models.OrderStatusRequest
+	if err = c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "reason is required",
+		})
+		return
+	}
+
+	param := &models.OrderStatusParam{
+		OrderID: orderId,
+		UserID:  int64(userIdF),
+		Reason:  strings.TrimSpace(req.Reason),
+	}
+
+	order, err := h.OrderUseCase.CancelOrder(c.Request.Context(), param)
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"param": param,
+			"err":   err.Error(),
+		}).Error("failed to cancel order")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to cancel order",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":       true,
+		"order_id": order.ID,
+		"status":   constant.OrderStatusTranslated[order.Status],
+	})
+}
+
+// CancelOrderItems let a customer cancel some quantity of specific items of their order. The route
+// requires an Idempotency-Key so a retried request doesn't cancel the units twice.
+func (h *OrderHandler) CancelOrderItems(c *gin.Context) {
+	userIdF, err := utils.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	orderId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || orderId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid order id",
+		})
+		return
+	}
+
+	var req models.OrderItemCancelRequest
+	if err = c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid request",
+		})
+		return
+	}
+
+	if strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "reason is required",
+		})
+		return
+	}
+
+	param := &models.OrderItemCancelParam{
+		OrderID: orderId,
+		UserID:  int64(userIdF),
+		Items:   req.Items,
+		Reason:  strings.TrimSpace(req.Reason),
+	}
+
+	order, err := h.OrderUseCase.CancelOrderItems(c.Request.Context(), param)
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"param": param,
+			"err":   err.Error(),
+		}).Error("failed to cancel order items")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to cancel order items",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":           true,
+		"order_id":     order.ID,
+		"status":       constant.OrderStatusTranslated[order.Status],
+		"total_amount": order.Amount,
+		"currency":     order.Currency,
+		"total_qty":    order.TotalQty,
+	})
+}
+
+func (h *OrderHandler) ProcessOrder(c *gin.Context) {
+	h.updateOrderStatus(c, constant.OrderStatusProcessing)
+}
+
+func (h *OrderHandler) CompleteOrder(c *gin.Context) {
+	h.updateOrderStatus(c, constant.OrderStatusCompleted)
+}
+
+func (h *OrderHandler) FailOrder(c *gin.Context) {
+	h.updateOrderStatus(c, constant.OrderStatusFailed)
+}
+
+// updateOrderStatus move any order to a staff driven status, the routes are admin only
+func (h *OrderHandler) updateOrderStatus(c *gin.Context, status int) {
+	orderId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || orderId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid order id",
+		})
+		return
+	}
+
+	// the body is optional, it only carries the reason of the transition
+	var req models.OrderStatusRequest
+	if err = c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid request",
+		})
+		return
+	}
+
+	param := &models.OrderStatusParam{
+		OrderID: orderId,
+		Status:  status,
+		Reason:  req.Reason,
+	}
+
+	order, err := h.OrderUseCase.UpdateOrderStatus(c.Request.Context(), param)
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"param": param,
+			"err":   err.Error(),
+		}).Error("failed to update order status")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to update order status",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":       true,
+		"order_id": order.ID,
+		"status":   constant.OrderStatusTranslated[order.Status],
+	})
+}
+
+func (h *OrderHandler) GetPaymentMethods(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": h.OrderUseCase.GetPaymentMethods(),
+	})
+}
+
+// errorStatusCode map usecase errors to the http status code returned to the client
+func errorStatusCode(err error) int {
+	switch {
+	case errors.Is(err, constant.ErrInvalidAddress), errors.Is(err, constant.ErrUnsupportedPayment),
+		errors.Is(err, constant.ErrPaymentNotAllowed), errors.Is(err, constant.ErrInvalidStatusRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, constant.ErrOrderNotFound), errors.Is(err, constant.ErrSagaNotFound),
+		errors.Is(err, constant.ErrAddressNotFound), errors.Is(err, constant.ErrReturnNotFound),
+		errors.Is(err, constant.ErrRefundNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, constant.ErrInvalidStatusTransition), errors.Is(err, constant.ErrInsufficientStock),
+		errors.Is(err, constant.ErrRequestInProgress), errors.Is(err, constant.ErrCancellationWindow),
+		errors.Is(err, constant.ErrInvalidReturnStatus), errors.Is(err, constant.ErrAddressConflict),
+		errors.Is(err, constant.ErrInvalidRefundRetry):
+		return http.StatusConflict
+	case errors.Is(err, product.ErrProductNotFound), errors.Is(err, constant.ErrIdempotencyKeyReused),
+		errors.Is(err, constant.ErrUnsupportedCurrency), errors.Is(err, money.ErrInvalidCurrency),
+		errors.Is(err, constant.ErrCouponNotFound), errors.Is(err, constant.ErrCouponNotApplicable),
+		errors.Is(err, constant.ErrCouponUsageExceeded), errors.Is(err, constant.ErrAddressBookFull),
+		errors.Is(err, constant.ErrInvalidItemCancel), errors.Is(err, constant.ErrInvalidReturn):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, product.ErrServiceUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"order_service/cmd/usecase"
+	"order_service/config"
+	"order_service/infra/constant"
+	"order_service/infra/log"
+	"order_service/models"
+)
+
+type PaymentEventHandler struct {
+	OrderUseCase usecase.OrderUseCase
+	Config       config.KafkaConsumerConfig
+}
+
+func NewPaymentEventHandler(orderUseCase usecase.OrderUseCase, cfg config.KafkaConsumerConfig) *PaymentEventHandler {
+	return &PaymentEventHandler{
+		OrderUseCase: orderUseCase,
+		Config:       cfg,
+	}
+}
+
+// Topics return the topics the payment handler consumes
+func (h *PaymentEventHandler) Topics() []string {
+	return []string{h.Config.PaymentSuccessTopic, h.Config.PaymentFailedTopic, h.Config.RefundSuccessTopic, h.Config.RefundFailedTopic}
+}
+
+// HandleMessage route a consumed message to the payment or the refund result handler
+func (h *PaymentEventHandler) HandleMessage(ctx context.Context, msg kafkago.Message) error {
+	switch msg.Topic {
+	case h.Config.RefundSuccessTopic, h.Config.RefundFailedTopic:
+		return h.HandleRefundResult(ctx, msg)
+	default:
+		return h.HandlePaymentResult(ctx, msg)
+	}
+}
+
+// HandlePaymentResult apply a payment.success or payment.failed event to its order
+func (h *PaymentEventHandler) HandlePaymentResult(ctx context.Context, msg kafkago.Message) error {
+	var status int
+	switch msg.Topic {
+	case h.Config.PaymentSuccessTopic:
+		status = constant.OrderStatusProcessing
+	case h.Config.PaymentFailedTopic:
+		status = constant.OrderStatusFailed
+	default:
+		log.Logger.WithFields(logrus.Fields{
+			"topic": msg.Topic,
+		}).Warn("skipping message from unknown topic")
+		return nil
+	}
+
+	var event models.PaymentResultEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil || event.OrderID <= 0 {
+		// a malformed message will never succeed, skip it instead of retrying forever
+		log.Logger.WithFields(logrus.Fields{
+			"topic":  msg.Topic,
+			"offset": msg.Offset,
+			"value":  string(msg.Value),
+		}).Error("skipping malformed payment event")
+		return nil
+	}
+
+	// prefer the payment id so a payment event published twice is applied once,
+	// otherwise fall back to the message position which is stable across redeliveries
+	eventKey := fmt.Sprintf("%s:%d:%d", msg.Topic, msg.Partition, msg.Offset)
+	if event.PaymentID != "" {
+		eventKey = fmt.Sprintf("%s:%s", msg.Topic, event.PaymentID)
+	}
+
+	return h.OrderUseCase.ApplyPaymentResult(ctx, &event, status, eventKey)
+}
+
+// HandleRefundResult apply a payment.refunded or payment.refund_failed event to its refund
+func (h *PaymentEventHandler) HandleRefundResult(ctx context.Context, msg kafkago.Message) error {
+	status := constant.RefundStatusCompleted
+	if msg.Topic == h.Config.RefundFailedTopic {
+		status = constant.RefundStatusFailed
+	}
+
+	var event models.RefundResultEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil || event.RefundID <= 0 {
+		// a malformed message will never succeed, skip it instead of retrying forever
+		log.Logger.WithFields(logrus.Fields{
+			"topic":  msg.Topic,
+			"offset": msg.Offset,
+			"value":  string(msg.Value),
+		}).Error("skipping malformed refund event")
+		return nil
+	}
+
+	// every attempt of a refund gets a single result, the refund id and the attempt identify its
+	// event across redeliveries
+	eventKey := fmt.Sprintf("%s:%d:%d", msg.Topic, event.RefundID, max(event.Attempt, 1))
+	return h.OrderUseCase.ApplyRefundResult(ctx, &event, status, eventKey)
+}
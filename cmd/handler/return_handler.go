@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"order_service/infra/constant"
+	"order_service/infra/log"
+	"order_service/infra/utils"
+	"order_service/models"
+	"strconv"
+	"strings"
+)
+
+// RequestOrderReturn let a customer return fulfilled items of their order, a reason is required
+func (h *OrderHandler) RequestOrderReturn(c *gin.Context) {
+	userIdF, err := utils.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	orderId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || orderId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid order id",
+		})
+		return
+	}
+
+	var req models.OrderReturnRequest
+	if err = c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid request",
+		})
+		return
+	}
+
+	if strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "reason is required",
+		})
+		return
+	}
+
+	param := &models.OrderReturnParam{
+		OrderID: orderId,
+		UserID:  int64(userIdF),
+		Items:   req.Items,
+		Reason:  strings.TrimSpace(req.Reason),
+	}
+
+	orderReturn, err := h.OrderUseCase.RequestOrderReturn(c.Request.Context(), param)
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"param": param,
+			"err":   err.Error(),
+		}).Error("failed to request order return")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to request order return",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": orderReturn,
+	})
+}
+
+func (h *OrderHandler) GetOrderReturns(c *gin.Context) {
+	userIdF, err := utils.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	orderId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || orderId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid order id",
+		})
+		return
+	}
+
+	returns, err := h.OrderUseCase.GetOrderReturns(c.Request.Context(), orderId, int64(userIdF))
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"order_id": orderId,
+			"user_id":  int64(userIdF),
+			"err":      err.Error(),
+		}).Error("failed to get order returns")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to get order returns",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": returns,
+	})
+}
+
+func (h *OrderHandler) ApproveOrderReturn(c *gin.Context) {
+	h.reviewOrderReturn(c, constant.ReturnStatusApproved)
+}
+
+func (h *OrderHandler) RejectOrderReturn(c *gin.Context) {
+	h.reviewOrderReturn(c, constant.ReturnStatusRejected)
+}
+
+func (h *OrderHandler) reviewOrderReturn(c *gin.Context, status int) {
+	returnId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || returnId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid return id",
+		})
+		return
+	}
+
+	// the body is optional, it only carries the review note
+	var req models.ReturnReviewRequest
+	if err = c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid request",
+		})
+		return
+	}
+
+	param := &models.ReturnReviewParam{
+		ReturnID: returnId,
+		Status:   status,
+		Note:     strings.TrimSpace(req.Note),
+	}
+
+	orderReturn, err := h.OrderUseCase.ReviewOrderReturn(c.Request.Context(), param)
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"param": param,
+			"err":   err.Error(),
+		}).Error("failed to review order return")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to review order return",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":        true,
+		"return_id": orderReturn.ID,
+		"status":    constant.ReturnStatusTranslated[orderReturn.Status],
+	})
+}
+
+// ReceiveOrderReturn mark the items of an approved return as received and request their refund
+func (h *OrderHandler) ReceiveOrderReturn(c *gin.Context) {
+	returnId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || returnId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid return id",
+		})
+		return
+	}
+
+	refund, err := h.OrderUseCase.ReceiveOrderReturn(c.Request.Context(), returnId)
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"return_id": returnId,
+			"err":       err.Error(),
+		}).Error("failed to receive order return")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to receive order return",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":        true,
+		"return_id": returnId,
+		"refund_id": refund.ID,
+		"amount":    refund.Amount,
+		"currency":  refund.Currency,
+		"status":    constant.RefundStatusTranslated[refund.Status],
+	})
+}
+
+// RetryOrderRefund request a failed refund again
+func (h *OrderHandler) RetryOrderRefund(c *gin.Context) {
+	refundId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || refundId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid refund id",
+		})
+		return
+	}
+
+	refund, err := h.OrderUseCase.RetryOrderRefund(c.Request.Context(), refundId)
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"refund_id": refundId,
+			"err":       err.Error(),
+		}).Error("failed to retry order refund")
+
+		c.JSON(errorStatusCode(err), gin.H{
+			"message": "failed to retry order refund",
+			"err":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":        true,
+		"refund_id": refund.ID,
+		"attempt":   refund.Attempt,
+		"amount":    refund.Amount,
+		"currency":  refund.Currency,
+		"status":    constant.RefundStatusTranslated[refund.Status],
+	})
+}
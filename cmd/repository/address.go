@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"order_service/models"
+	"time"
+)
+
+// GetUserAddresses get the address book of a user, the default address first
+func (r *OrderRepository) GetUserAddresses(ctx context.Context, userID int64) ([]models.UserAddress, error) {
+	var addresses []models.UserAddress
+	err := r.Database.WithContext(ctx).Table("user_address").
+		Where("user_id = ?", userID).
+		Order("is_default DESC, id DESC").
+		Find(&addresses).Error
+	if err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+// GetUserAddress get an address of the user's address book
+func (r *OrderRepository) GetUserAddress(ctx context.Context, userID int64, addressID int64) (*models.UserAddress, error) {
+	var address models.UserAddress
+	err := r.Database.WithContext(ctx).Table("user_address").
+		Where("id = ? AND user_id = ?", addressID, userID).
+		First(&address).Error
+	if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// GetDefaultUserAddress get the default address of a user
+func (r *OrderRepository) GetDefaultUserAddress(ctx context.Context, userID int64) (*models.UserAddress, error) {
+	var address models.UserAddress
+	err := r.Database.WithContext(ctx).Table("user_address").
+		Where("user_id = ? AND is_default", userID).
+		First(&address).Error
+	if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// LockUserAddressesTx get the address book of a user, newest first, and lock it until the
+// transaction ends so default changes are serialized. Row locks can't hold off an insert into an
+// empty book, so the user id is locked too: two first addresses can't both become the default.
+func (r *OrderRepository) LockUserAddressesTx(ctx context.Context, tx *gorm.DB, userID int64) ([]models.UserAddress, error) {
+	err := tx.WithContext(ctx).Exec("SELECT pg_advisory_xact_lock(?)", userID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []models.UserAddress
+	err = tx.WithContext(ctx).Table("user_address").
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Find(&addresses).Error
+	if err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+// InsertUserAddressTx insert user address
+func (r *OrderRepository) InsertUserAddressTx(ctx context.Context, tx *gorm.DB, address *models.UserAddress) error {
+	err := tx.WithContext(ctx).Table("user_address").Create(address).Error
+	return err
+}
+
+// UpdateUserAddressTx update the label, address and default flag of a user address
+func (r *OrderRepository) UpdateUserAddressTx(ctx context.Context, tx *gorm.DB, address *models.UserAddress) error {
+	err := tx.WithContext(ctx).Table("user_address").
+		Where("id = ? AND user_id = ?", address.ID, address.UserID).
+		Updates(map[string]interface{}{
+			"label":       address.Label,
+			"address":     address.Address,
+			"is_default":  address.IsDefault,
+			"update_time": address.UpdateTime,
+		}).Error
+	return err
+}
+
+// ClearDefaultUserAddressTx unset the default address of a user
+func (r *OrderRepository) ClearDefaultUserAddressTx(ctx context.Context, tx *gorm.DB, userID int64) error {
+	err := tx.WithContext(ctx).Table("user_address").
+		Where("user_id = ? AND is_default", userID).
+		Updates(map[string]interface{}{
+			"is_default":  false,
+			"update_time": time.Now(),
+		}).Error
+	return err
+}
+
+// SetDefaultUserAddressTx make an address the default address of its user
+func (r *OrderRepository) SetDefaultUserAddressTx(ctx context.Context, tx *gorm.DB, userID int64, addressID int64) error {
+	err := tx.WithContext(ctx).Table("user_address").
+		Where("id = ? AND user_id = ?", addressID, userID).
+		Updates(map[string]interface{}{
+			"is_default":  true,
+			"update_time": time.Now(),
+		}).Error
+	return err
+}
+
+// DeleteUserAddressTx delete an address of the user's address book
+func (r *OrderRepository) DeleteUserAddressTx(ctx context.Context, tx *gorm.DB, userID int64, addressID int64) error {
+	err := tx.WithContext(ctx).Table("user_address").
+		Where("id = ? AND user_id = ?", addressID, userID).
+		Delete(nil).Error
+	return err
+}
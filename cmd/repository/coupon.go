@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"order_service/models"
+)
+
+// GetCouponsByCodes get the coupons of the given codes, unknown codes are left out
+func (r *OrderRepository) GetCouponsByCodes(ctx context.Context, codes []string) ([]models.Coupon, error) {
+	var coupons []models.Coupon
+	err := r.Database.WithContext(ctx).Table("coupon").
+		Where("code IN ?", codes).
+		Find(&coupons).Error
+	if err != nil {
+		return nil, err
+	}
+	return coupons, nil
+}
+
+// GetCouponForUpdateTx get a coupon and lock it until the transaction ends
+func (r *OrderRepository) GetCouponForUpdateTx(ctx context.Context, tx *gorm.DB, couponID int64) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := tx.WithContext(ctx).Table("coupon").
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", couponID).
+		First(&coupon).Error
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// CountCouponUsage count how many orders of the user used the coupon
+func (r *OrderRepository) CountCouponUsage(ctx context.Context, couponID int64, userID int64) (int64, error) {
+	return r.countCouponUsage(r.Database.WithContext(ctx), couponID, userID)
+}
+
+// CountCouponUsageTx count how many orders of the user used the coupon
+func (r *OrderRepository) CountCouponUsageTx(ctx context.Context, tx *gorm.DB, couponID int64, userID int64) (int64, error) {
+	return r.countCouponUsage(tx.WithContext(ctx), couponID, userID)
+}
+
+func (r *OrderRepository) countCouponUsage(db *gorm.DB, couponID int64, userID int64) (int64, error) {
+	var count int64
+	err := db.Table("coupon_usage").
+		Where("coupon_id = ? AND user_id = ?", couponID, userID).
+		Count(&count).Error
+	return count, err
+}
+
+// InsertCouponUsageTx insert coupon usage
+func (r *OrderRepository) InsertCouponUsageTx(ctx context.Context, tx *gorm.DB, usage *models.CouponUsage) error {
+	err := tx.WithContext(ctx).Table("coupon_usage").Create(usage).Error
+	return err
+}
+
+// DeleteCouponUsageByOrderTx delete the coupon usages of an order
+func (r *OrderRepository) DeleteCouponUsageByOrderTx(ctx context.Context, tx *gorm.DB, orderID int64) error {
+	err := tx.WithContext(ctx).Table("coupon_usage").Where("order_id = ?", orderID).Delete(nil).Error
+	return err
+}
@@ -2,11 +2,10 @@ package repository
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"order_service/infra/constant"
 	"order_service/infra/log"
 	"order_service/models"
@@ -71,17 +70,25 @@ func (r *OrderRepository) InsertOrderDetailTx(ctx context.Context, tx *gorm.DB,
 	return err
 }
 
-// CheckIdempotency check idempotency
-func (r *OrderRepository) CheckIdempotency(ctx context.Context, idempotencyKey string) (bool, error) {
-	var reqLog *models.OrderRequestLog
-	err := r.Database.WithContext(ctx).Table("order_request_log").First(&reqLog, "idempotency_token = ?", idempotencyKey).Error
+// GetOrderDetailTx get order detail
+func (r *OrderRepository) GetOrderDetailTx(ctx context.Context, tx *gorm.DB, orderDetailID int64) (*models.OrderDetail, error) {
+	var orderDetail models.OrderDetail
+	err := tx.WithContext(ctx).Table("order_detail").Where("id = ?", orderDetailID).First(&orderDetail).Error
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return false, nil
-		}
-		return false, err
+		return nil, err
 	}
-	return true, nil
+	return &orderDetail, nil
+}
+
+// GetIdempotency get the request log of an idempotency token of a user
+func (r *OrderRepository) GetIdempotency(ctx context.Context, userID int64, idempotencyKey string) (*models.OrderRequestLog, error) {
+	var reqLog models.OrderRequestLog
+	err := r.Database.WithContext(ctx).Table("order_request_log").
+		First(&reqLog, "user_id = ? AND idempotency_token = ?", userID, idempotencyKey).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reqLog, nil
 }
 
 // SaveIdempotency save idempotency
@@ -102,16 +109,12 @@ func (r *OrderRepository) SaveIdempotency(ctx context.Context, idempotencyKey st
 	return nil
 }
 
-func (r *OrderRepository) SaveIdempotencyTx(ctx context.Context, tx *gorm.DB, idempotencyKey string) error {
-	orderLog := models.OrderRequestLog{
-		IdempotencyToken: idempotencyKey,
-		CreateTime:       time.Now(),
-	}
-
-	err := tx.WithContext(ctx).Table("order_request_log").Create(&orderLog).Error
+// SaveIdempotencyTx save the request log of an idempotency token along with the order it created
+func (r *OrderRepository) SaveIdempotencyTx(ctx context.Context, tx *gorm.DB, orderLog *models.OrderRequestLog) error {
+	err := tx.WithContext(ctx).Table("order_request_log").Create(orderLog).Error
 	if err != nil {
 		log.Logger.WithFields(logrus.Fields{
-			"message": fmt.Sprintf("error occured on r.Database.WithContext(ctx).Table(\"order_request_log\").Create(&orderLog).Error"),
+			"message": fmt.Sprintf("error occured on tx.WithContext(ctx).Table(\"order_request_log\").Create(orderLog).Error"),
 			"error":   err,
 		})
 		return err
@@ -119,61 +122,280 @@ func (r *OrderRepository) SaveIdempotencyTx(ctx context.Context, tx *gorm.DB, id
 	return nil
 }
 
-func (r *OrderRepository) GetOrderHistoryByUserId(ctx context.Context, param *models.OrderHistoryParam) ([]models.OrderHistoryResponse, error) {
+// GetOrderForUpdateTx get order by id and lock the row until the transaction ends.
+// The order is only matched against the user when userID is greater than zero.
+func (r *OrderRepository) GetOrderForUpdateTx(ctx context.Context, tx *gorm.DB, orderID int64, userID int64) (*models.Order, error) {
+	var order models.Order
+	query := tx.WithContext(ctx).Table("orders").
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", orderID)
 
-	var queryResult []models.OrderHistoryResult
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
 
-	query := r.Database.WithContext(ctx).
+	err := query.First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// SaveProcessedEventTx record a consumed event key, it returns false when the key was already recorded
+func (r *OrderRepository) SaveProcessedEventTx(ctx context.Context, tx *gorm.DB, eventKey string, orderID int64) (bool, error) {
+	processedEvent := models.OrderProcessedEvent{
+		EventKey:   eventKey,
+		OrderID:    orderID,
+		CreateTime: time.Now(),
+	}
+
+	result := tx.WithContext(ctx).Table("order_processed_event").
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "event_key"}}, DoNothing: true}).
+		Create(&processedEvent)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateOrderStatusTx update order status
+func (r *OrderRepository) UpdateOrderStatusTx(ctx context.Context, tx *gorm.DB, orderID int64, status int) error {
+	err := tx.WithContext(ctx).Table("orders").
+		Where("id = ?", orderID).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"update_time": time.Now(),
+		}).Error
+	return err
+}
+
+// UpdateOrderPricingTx update the amounts and total quantity of an order after its items changed
+func (r *OrderRepository) UpdateOrderPricingTx(ctx context.Context, tx *gorm.DB, order *models.Order) error {
+	err := tx.WithContext(ctx).Table("orders").
+		Where("id = ?", order.ID).
+		Updates(map[string]interface{}{
+			"amount":          order.Amount,
+			"subtotal":        order.Subtotal,
+			"discount_amount": order.DiscountAmount,
+			"shipping_fee":    order.ShippingFee,
+			"tax_amount":      order.TaxAmount,
+			"base_amount":     order.BaseAmount,
+			"total_qty":       order.TotalQty,
+			"update_time":     time.Now(),
+		}).Error
+	return err
+}
+
+// UpdateOrderDiscountsTx replace the discounts of an order detail
+func (r *OrderRepository) UpdateOrderDiscountsTx(ctx context.Context, tx *gorm.DB, orderDetailID int64, discounts []models.AppliedDiscount) error {
+	err := tx.WithContext(ctx).Table("order_detail").
+		Where("id = ?", orderDetailID).
+		Select("discounts").
+		Updates(&models.OrderDetail{Discounts: discounts}).Error
+	return err
+}
+
+// InsertOrderStatusHistoryTx append an entry to the status timeline of an order
+func (r *OrderRepository) InsertOrderStatusHistoryTx(ctx context.Context, tx *gorm.DB, entry *models.OrderStatusHistory) error {
+	err := tx.WithContext(ctx).Table("order_status_history").Create(entry).Error
+	return err
+}
+
+// orderHistoryQuery build the orders and order_detail join shared by the order read paths
+func (r *OrderRepository) orderHistoryQuery(ctx context.Context) *gorm.DB {
+	return r.Database.WithContext(ctx).
 		Table("orders AS o").
 		Select(`
 		o.id, 
 		o.total_qty, 
 		o.amount, 
+		o.currency, 
+		o.subtotal, 
+		o.discount_amount, 
+		o.shipping_fee, 
+		o.tax_amount, 
+		o.pricing_region, 
+		o.base_amount, 
+		o.base_currency, 
+		o.exchange_rate, 
 		o.status, 
 		o.payment_method, 
 		o.shipping_address, 
-		od.products, 
-		od.order_history`).
-		Joins("JOIN order_detail AS od ON od.id = o.order_detail_id").
+		o.shipping_address_detail, 
+		o.create_time, 
+		o.update_time, 
+		od.discounts`).
+		Joins("LEFT JOIN order_detail AS od ON od.id = o.order_detail_id")
+}
+
+func (r *OrderRepository) GetOrderHistoryByUserId(ctx context.Context, param *models.OrderHistoryParam) ([]models.OrderHistoryResponse, error) {
+
+	var queryResult []models.OrderHistoryResult
+
+	query := r.orderHistoryQuery(ctx).
 		Where("o.user_id = ?", param.UserID)
 
-	if param.Status > 0 {
-		query.Where("o.status = ?", param.Status)
+	if len(param.Statuses) > 0 {
+		query = query.Where("o.status IN ?", param.Statuses)
+	}
+
+	if param.From != nil {
+		query = query.Where("o.create_time >= ?", *param.From)
+	}
+
+	if param.To != nil {
+		query = query.Where("o.create_time < ?", *param.To)
+	}
+
+	if param.ProductID > 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM order_items AS oi WHERE oi.order_id = o.id AND oi.product_id = ?)", param.ProductID)
 	}
 
-	err := query.Order("o.id DESC").Scan(&queryResult).Error
+	// keyset pagination, the cursor is the id of the last order of the previous page
+	if param.Sort == constant.SortAsc {
+		if param.Cursor > 0 {
+			query = query.Where("o.id > ?", param.Cursor)
+		}
+		query = query.Order("o.id ASC")
+	} else {
+		if param.Cursor > 0 {
+			query = query.Where("o.id < ?", param.Cursor)
+		}
+		query = query.Order("o.id DESC")
+	}
+
+	err := query.Limit(param.Limit).Scan(&queryResult).Error
 	if err != nil {
 		return nil, err
 	}
 
-	var results []models.OrderHistoryResponse
-	for _, result := range queryResult {
-		var products []models.CheckoutItem
-		var history []models.StatusHistory
+	return r.toOrderHistoryResponses(ctx, queryResult)
+}
 
-		err = json.Unmarshal([]byte(result.Products), &products)
-		if err != nil {
-			return nil, err
-		}
+// GetOrderDetailByID get a single order of the user, it returns gorm.ErrRecordNotFound when
+// the order doesn't exist or belongs to another user
+func (r *OrderRepository) GetOrderDetailByID(ctx context.Context, orderID int64, userID int64) (*models.OrderDetailResponse, error) {
+	var queryResult models.OrderHistoryResult
 
-		err = json.Unmarshal([]byte(result.History), &history)
-		if err != nil {
-			return nil, err
-		}
+	query := r.orderHistoryQuery(ctx).
+		Where("o.id = ?", orderID).
+		Where("o.user_id = ?", userID).
+		Scan(&queryResult)
+	if query.Error != nil {
+		return nil, query.Error
+	}
+
+	if query.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	responses, err := r.toOrderHistoryResponses(ctx, []models.OrderHistoryResult{queryResult})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OrderDetailResponse{
+		OrderHistoryResponse: responses[0],
+		CreateTime:           queryResult.CreateTime,
+		UpdateTime:           queryResult.UpdateTime,
+	}, nil
+}
+
+// toOrderHistoryResponses load the items and the status timeline of the order rows in two
+// queries and build their responses
+func (r *OrderRepository) toOrderHistoryResponses(ctx context.Context, results []models.OrderHistoryResult) ([]models.OrderHistoryResponse, error) {
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	orderIDs := make([]int64, 0, len(results))
+	for _, result := range results {
+		orderIDs = append(orderIDs, result.ID)
+	}
+
+	var items []models.OrderItem
+	err := r.Database.WithContext(ctx).Table("order_items").
+		Where("order_id IN ?", orderIDs).
+		Order("id ASC").
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var history []models.OrderStatusHistory
+	err = r.Database.WithContext(ctx).Table("order_status_history").
+		Where("order_id IN ?", orderIDs).
+		Order("id ASC").
+		Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
 
-		results = append(results, models.OrderHistoryResponse{
-			OrderID:         result.ID,
-			TotalAmount:     result.Amount,
-			TotalQty:        result.TotalQty,
-			Status:          constant.OrderStatusTranslated[result.Status],
-			PaymentMethod:   result.PaymentMethod,
-			ShippingAddress: result.ShippingAddress,
-			Products:        products,
-			History:         history,
+	productsOfOrder := make(map[int64][]models.CheckoutItem, len(results))
+	for _, item := range items {
+		productsOfOrder[item.OrderID] = append(productsOfOrder[item.OrderID], models.CheckoutItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Price:     item.UnitPrice,
+			BasePrice: item.BaseUnitPrice,
+			Weight:    item.Weight,
 		})
 	}
 
-	return results, nil
+	historyOfOrder := make(map[int64][]models.StatusHistory, len(results))
+	for _, entry := range history {
+		historyOfOrder[entry.OrderID] = append(historyOfOrder[entry.OrderID], models.StatusHistory{
+			Status:    entry.Status,
+			Timestamp: entry.CreateTime.Format(time.RFC3339Nano),
+			Reason:    entry.Reason,
+		})
+	}
+
+	responses := make([]models.OrderHistoryResponse, 0, len(results))
+	for _, result := range results {
+		responses = append(responses, toOrderHistoryResponse(result, productsOfOrder[result.ID], historyOfOrder[result.ID]))
+	}
+	return responses, nil
+}
+
+func toOrderHistoryResponse(result models.OrderHistoryResult, products []models.CheckoutItem, history []models.StatusHistory) models.OrderHistoryResponse {
+	if products == nil {
+		products = []models.CheckoutItem{}
+	}
+
+	if history == nil {
+		history = []models.StatusHistory{}
+	}
+
+	discounts := result.Discounts
+	if discounts == nil {
+		discounts = []models.AppliedDiscount{}
+	}
+
+	return models.OrderHistoryResponse{
+		OrderID:               result.ID,
+		TotalAmount:           result.Amount,
+		Currency:              result.Currency,
+		PricingRegion:         result.PricingRegion,
+		BaseAmount:            result.BaseAmount,
+		BaseCurrency:          result.BaseCurrency,
+		ExchangeRate:          result.ExchangeRate,
+		TotalQty:              result.TotalQty,
+		Status:                constant.OrderStatusTranslated[result.Status],
+		PaymentMethod:         result.PaymentMethod,
+		ShippingAddress:       result.ShippingAddress,
+		ShippingAddressDetail: result.ShippingAddressDetail,
+		Products:              products,
+		Discounts:             discounts,
+		History:               history,
+		PriceBreakdown: models.PriceBreakdown{
+			Subtotal:    result.Subtotal,
+			Discount:    result.DiscountAmount,
+			ShippingFee: result.ShippingFee,
+			Tax:         result.TaxAmount,
+			GrandTotal:  result.Amount,
+		},
+	}
 }
 
 func (r *OrderRepository) DeleteOrder(ctx context.Context, orderID int64) error {
@@ -189,7 +411,7 @@ func (r *OrderRepository) DeleteOrder(ctx context.Context, orderID int64) error
 }
 
 func (r *OrderRepository) DeleteOrderDetails(ctx context.Context, orderDetailID int64) error {
-	err := r.Database.WithContext(ctx).Table("order_details").Where("id = ?", orderDetailID).Delete(nil).Error
+	err := r.Database.WithContext(ctx).Table("order_detail").Where("id = ?", orderDetailID).Delete(nil).Error
 	if err != nil {
 		log.Logger.WithFields(logrus.Fields{
 			"err":             err.Error(),
@@ -212,3 +434,353 @@ func (r *OrderRepository) DeleteIdempToken(ctx context.Context, idempotencyKey i
 	}
 	return nil
 }
+
+// InsertOutboxTx insert an event into the outbox so it is only published once the transaction commits
+func (r *OrderRepository) InsertOutboxTx(ctx context.Context, tx *gorm.DB, outbox *models.OrderOutbox) error {
+	err := tx.WithContext(ctx).Table("order_outbox").Create(outbox).Error
+	return err
+}
+
+// ClaimOutboxTx claim the due outbox events that are the oldest pending event of their message key,
+// so the events of one key are published in insertion order while other keys don't wait on it.
+// Claimed events are hidden from other relays until claimUntil, when a relay that died mid-publish
+// leaves them to be retried.
+func (r *OrderRepository) ClaimOutboxTx(ctx context.Context, tx *gorm.DB, limit int, claimUntil time.Time) ([]models.OrderOutbox, error) {
+	var outboxes []models.OrderOutbox
+	err := tx.WithContext(ctx).Raw(`
+		SELECT o.* FROM order_outbox o
+		WHERE o.status = ? AND o.next_attempt_time <= ?
+		AND NOT EXISTS (
+			SELECT 1 FROM order_outbox p
+			WHERE p.message_key = o.message_key AND p.status = ? AND p.id < o.id
+		)
+		ORDER BY o.id ASC
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED`,
+		constant.OutboxStatusPending, time.Now(), constant.OutboxStatusPending, limit).
+		Scan(&outboxes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(outboxes) == 0 {
+		return outboxes, nil
+	}
+
+	ids := make([]int64, 0, len(outboxes))
+	for _, outbox := range outboxes {
+		ids = append(ids, outbox.ID)
+	}
+
+	err = tx.WithContext(ctx).Table("order_outbox").
+		Where("id IN ?", ids).
+		Update("next_attempt_time", claimUntil).Error
+	if err != nil {
+		return nil, err
+	}
+	return outboxes, nil
+}
+
+// MarkOutboxSent mark outbox event as published
+func (r *OrderRepository) MarkOutboxSent(ctx context.Context, outboxID int64) error {
+	err := r.Database.WithContext(ctx).Table("order_outbox").
+		Where("id = ?", outboxID).
+		Updates(map[string]interface{}{
+			"status":    constant.OutboxStatusSent,
+			"sent_time": time.Now(),
+		}).Error
+	return err
+}
+
+// MarkOutboxFailed record a failed publish attempt and when the event may be retried
+func (r *OrderRepository) MarkOutboxFailed(ctx context.Context, outboxID int64, attempts int, lastErr string, nextAttempt time.Time) error {
+	err := r.Database.WithContext(ctx).Table("order_outbox").
+		Where("id = ?", outboxID).
+		Updates(map[string]interface{}{
+			"attempts":          attempts,
+			"last_error":        lastErr,
+			"next_attempt_time": nextAttempt,
+		}).Error
+	return err
+}
+
+// InsertStockReservation record a stock reservation before it is requested from the product service.
+// Inserting a reservation id that already exists is a no-op so a resumed checkout can retry it.
+func (r *OrderRepository) InsertStockReservation(ctx context.Context, reservation *models.StockReservation) error {
+	err := r.Database.WithContext(ctx).Table("order_stock_reservation").
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "reservation_id"}}, DoNothing: true}).
+		Create(reservation).Error
+	return err
+}
+
+// GetStockReservation get stock reservation by id
+func (r *OrderRepository) GetStockReservation(ctx context.Context, reservationID string) (*models.StockReservation, error) {
+	var reservation models.StockReservation
+	err := r.Database.WithContext(ctx).Table("order_stock_reservation").
+		Where("reservation_id = ?", reservationID).
+		First(&reservation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// AttachStockReservationTx link a stock reservation to the order it was made for
+func (r *OrderRepository) AttachStockReservationTx(ctx context.Context, tx *gorm.DB, reservationID string, orderID int64) error {
+	err := tx.WithContext(ctx).Table("order_stock_reservation").
+		Where("reservation_id = ?", reservationID).
+		Updates(map[string]interface{}{
+			"order_id":    orderID,
+			"update_time": time.Now(),
+		}).Error
+	return err
+}
+
+// UpdateStockReservationStatus update stock reservation status
+func (r *OrderRepository) UpdateStockReservationStatus(ctx context.Context, reservationID string, status int) error {
+	err := r.Database.WithContext(ctx).Table("order_stock_reservation").
+		Where("reservation_id = ?", reservationID).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"update_time": time.Now(),
+		}).Error
+	return err
+}
+
+// GetStockReservationByOrderID get the stock reservation of an order
+func (r *OrderRepository) GetStockReservationByOrderID(ctx context.Context, orderID int64) (*models.StockReservation, error) {
+	var reservation models.StockReservation
+	err := r.Database.WithContext(ctx).Table("order_stock_reservation").
+		Where("order_id = ?", orderID).
+		First(&reservation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// GetPendingStockReservations get reservations that still need an action from the sweeper:
+// abandoned ones past their expiry, ones whose order was saved but not confirmed yet,
+// and ones still holding stock for a cancelled or failed order
+func (r *OrderRepository) GetPendingStockReservations(ctx context.Context, limit int) ([]models.StockReservationResult, error) {
+	var reservations []models.StockReservationResult
+	err := r.Database.WithContext(ctx).
+		Table("order_stock_reservation AS r").
+		Select("r.*, o.status AS order_status").
+		Joins("LEFT JOIN orders AS o ON o.id = r.order_id").
+		Where(`(r.status = ? AND (r.order_id IS NOT NULL OR r.expire_time < ?))
+			OR (r.status IN ? AND o.status IN ?)`,
+			constant.StockReservationStatusReserved, time.Now(),
+			[]int{constant.StockReservationStatusReserved, constant.StockReservationStatusConfirmed},
+			[]int{constant.OrderStatusCancelled, constant.OrderStatusFailed}).
+		Order("r.create_time ASC").
+		Limit(limit).
+		Scan(&reservations).Error
+	if err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+// CountStockItemReleasesTx count the partial stock releases recorded for an order
+func (r *OrderRepository) CountStockItemReleasesTx(ctx context.Context, tx *gorm.DB, orderID int64) (int64, error) {
+	var count int64
+	err := tx.WithContext(ctx).Table("order_stock_item_release").
+		Where("order_id = ?", orderID).
+		Count(&count).Error
+	return count, err
+}
+
+// InsertStockItemReleaseTx record a partial stock release to apply once the transaction commits
+func (r *OrderRepository) InsertStockItemReleaseTx(ctx context.Context, tx *gorm.DB, release *models.StockItemRelease) error {
+	err := tx.WithContext(ctx).Table("order_stock_item_release").Create(release).Error
+	return err
+}
+
+// UpdateStockItemReleaseStatus update partial stock release status
+func (r *OrderRepository) UpdateStockItemReleaseStatus(ctx context.Context, releaseID string, status int) error {
+	err := r.Database.WithContext(ctx).Table("order_stock_item_release").
+		Where("release_id = ?", releaseID).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"update_time": time.Now(),
+		}).Error
+	return err
+}
+
+// GetPendingStockItemReleases get the partial stock releases the product service didn't apply yet
+func (r *OrderRepository) GetPendingStockItemReleases(ctx context.Context, limit int) ([]models.StockItemRelease, error) {
+	var releases []models.StockItemRelease
+	err := r.Database.WithContext(ctx).Table("order_stock_item_release").
+		Where("status = ?", constant.StockItemReleaseStatusPending).
+		Order("create_time ASC").
+		Limit(limit).
+		Find(&releases).Error
+	if err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// InsertCheckoutSaga insert checkout saga
+func (r *OrderRepository) InsertCheckoutSaga(ctx context.Context, saga *models.CheckoutSaga) error {
+	err := r.Database.WithContext(ctx).Table("checkout_saga").Create(saga).Error
+	return err
+}
+
+// UpdateCheckoutSaga persist the progress of a checkout saga
+func (r *OrderRepository) UpdateCheckoutSaga(ctx context.Context, saga *models.CheckoutSaga) error {
+	err := r.Database.WithContext(ctx).Table("checkout_saga").
+		Where("id = ?", saga.ID).
+		Updates(map[string]interface{}{
+			"order_id":     saga.OrderID,
+			"status":       saga.Status,
+			"current_step": saga.CurrentStep,
+			"payload":      saga.Payload,
+			"last_error":   saga.LastError,
+			"update_time":  saga.UpdateTime,
+		}).Error
+	return err
+}
+
+// GetCheckoutSaga get checkout saga by id.
+// The saga is only matched against the user when userID is greater than zero.
+func (r *OrderRepository) GetCheckoutSaga(ctx context.Context, sagaID string, userID int64) (*models.CheckoutSaga, error) {
+	var saga models.CheckoutSaga
+	query := r.Database.WithContext(ctx).Table("checkout_saga").Where("id = ?", sagaID)
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	err := query.First(&saga).Error
+	if err != nil {
+		return nil, err
+	}
+	return &saga, nil
+}
+
+// GetCheckoutSagaByOrderID get the checkout saga that created an order
+func (r *OrderRepository) GetCheckoutSagaByOrderID(ctx context.Context, orderID int64) (*models.CheckoutSaga, error) {
+	var saga models.CheckoutSaga
+	err := r.Database.WithContext(ctx).Table("checkout_saga").
+		Where("order_id = ?", orderID).
+		First(&saga).Error
+	if err != nil {
+		return nil, err
+	}
+	return &saga, nil
+}
+
+// GetStaleCheckoutSagas get sagas in one of the statuses that were not updated since before
+func (r *OrderRepository) GetStaleCheckoutSagas(ctx context.Context, statuses []int, before time.Time, limit int) ([]models.CheckoutSaga, error) {
+	var sagas []models.CheckoutSaga
+	err := r.Database.WithContext(ctx).Table("checkout_saga").
+		Where("status IN ?", statuses).
+		Where("update_time < ?", before).
+		Order("update_time ASC").
+		Limit(limit).
+		Find(&sagas).Error
+	if err != nil {
+		return nil, err
+	}
+	return sagas, nil
+}
+
+// ClaimCheckoutSaga bump the saga update_time only if nobody touched it since it was read,
+// it returns false when another worker claimed or progressed the saga first
+func (r *OrderRepository) ClaimCheckoutSaga(ctx context.Context, saga *models.CheckoutSaga, claimTime time.Time) (bool, error) {
+	result := r.Database.WithContext(ctx).Table("checkout_saga").
+		Where("id = ? AND update_time = ?", saga.ID, saga.UpdateTime).
+		Update("update_time", claimTime)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// InsertIdempotencyKey insert an in progress idempotency key, it returns false when the user already used the key
+func (r *OrderRepository) InsertIdempotencyKey(ctx context.Context, record *models.IdempotencyKey) (bool, error) {
+	result := r.Database.WithContext(ctx).Table("idempotency_key").
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "idempotency_key"}},
+			DoNothing: true,
+		}).
+		Create(record)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetIdempotencyKey get the idempotency key of a user
+func (r *OrderRepository) GetIdempotencyKey(ctx context.Context, userID int64, key string) (*models.IdempotencyKey, error) {
+	var record models.IdempotencyKey
+	err := r.Database.WithContext(ctx).Table("idempotency_key").
+		Where("user_id = ? AND idempotency_key = ?", userID, key).
+		First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ClaimStaleIdempotencyKey take over an idempotency key whose lock expired before now, its request died
+// without completing it. It returns false when the key completed or is still held.
+func (r *OrderRepository) ClaimStaleIdempotencyKey(ctx context.Context, record *models.IdempotencyKey, now time.Time) (bool, error) {
+	result := r.Database.WithContext(ctx).Table("idempotency_key").
+		Where("id = ? AND status = ? AND lock_expire_time < ?", record.ID, constant.IdempotencyStatusInProgress, now).
+		Updates(map[string]interface{}{
+			"method":           record.Method,
+			"path":             record.Path,
+			"request_hash":     record.RequestHash,
+			"create_time":      record.CreateTime,
+			"expire_time":      record.ExpireTime,
+			"lock_expire_time": record.LockExpireTime,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RefreshIdempotencyKeyLock extend the lock of an idempotency key still in progress
+func (r *OrderRepository) RefreshIdempotencyKeyLock(ctx context.Context, id int64, lockExpireTime time.Time) error {
+	err := r.Database.WithContext(ctx).Table("idempotency_key").
+		Where("id = ? AND status = ?", id, constant.IdempotencyStatusInProgress).
+		Update("lock_expire_time", lockExpireTime).Error
+	return err
+}
+
+// CompleteIdempotencyKey store the response of the request that owns the idempotency key
+func (r *OrderRepository) CompleteIdempotencyKey(ctx context.Context, id int64, responseStatus int, responseBody string) error {
+	err := r.Database.WithContext(ctx).Table("idempotency_key").
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":          constant.IdempotencyStatusCompleted,
+			"response_status": responseStatus,
+			"response_body":   responseBody,
+		}).Error
+	return err
+}
+
+// DeleteIdempotencyKey delete idempotency key
+func (r *OrderRepository) DeleteIdempotencyKey(ctx context.Context, id int64) error {
+	err := r.Database.WithContext(ctx).Table("idempotency_key").Where("id = ?", id).Delete(nil).Error
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys delete at most limit idempotency keys that expired before now
+func (r *OrderRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time, limit int) (int64, error) {
+	result := r.Database.WithContext(ctx).Exec(`
+		DELETE FROM idempotency_key
+		WHERE id IN (SELECT id FROM idempotency_key WHERE expire_time < ? LIMIT ?)`, now, limit)
+	return result.RowsAffected, result.Error
+}
+
+// DeleteOrderRequestLogsBefore delete at most limit order request logs created before
+func (r *OrderRepository) DeleteOrderRequestLogsBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	result := r.Database.WithContext(ctx).Exec(`
+		DELETE FROM order_request_log
+		WHERE id IN (SELECT id FROM order_request_log WHERE create_time < ? LIMIT ?)`, before, limit)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"order_service/infra/constant"
+	"order_service/models"
+	"time"
+)
+
+// InsertOrderItemsTx insert the line items of an order
+func (r *OrderRepository) InsertOrderItemsTx(ctx context.Context, tx *gorm.DB, items []models.OrderItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	err := tx.WithContext(ctx).Table("order_items").Create(&items).Error
+	return err
+}
+
+// GetOrderItems get the line items of an order
+func (r *OrderRepository) GetOrderItems(ctx context.Context, orderID int64) ([]models.OrderItem, error) {
+	return r.getOrderItems(r.Database.WithContext(ctx), orderID)
+}
+
+// GetOrderItemsTx get the line items of an order
+func (r *OrderRepository) GetOrderItemsTx(ctx context.Context, tx *gorm.DB, orderID int64) ([]models.OrderItem, error) {
+	return r.getOrderItems(tx.WithContext(ctx), orderID)
+}
+
+func (r *OrderRepository) getOrderItems(db *gorm.DB, orderID int64) ([]models.OrderItem, error) {
+	var items []models.OrderItem
+	err := db.Table("order_items").
+		Where("order_id = ?", orderID).
+		Order("id ASC").
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// UpdateOrderItemQtyTx update the status and the fulfilled, cancelled and refunded quantities of an item
+func (r *OrderRepository) UpdateOrderItemQtyTx(ctx context.Context, tx *gorm.DB, item *models.OrderItem) error {
+	err := tx.WithContext(ctx).Table("order_items").
+		Where("id = ?", item.ID).
+		Updates(map[string]interface{}{
+			"status":        item.Status,
+			"fulfilled_qty": item.FulfilledQty,
+			"cancelled_qty": item.CancelledQty,
+			"refunded_qty":  item.RefundedQty,
+			"update_time":   time.Now(),
+		}).Error
+	return err
+}
+
+// CancelOrderItemsTx cancel every unit of an order that was not fulfilled
+func (r *OrderRepository) CancelOrderItemsTx(ctx context.Context, tx *gorm.DB, orderID int64) error {
+	err := tx.WithContext(ctx).Table("order_items").
+		Where("order_id = ? AND fulfilled_qty = 0", orderID).
+		Updates(map[string]interface{}{
+			"status":        constant.OrderItemStatusCancelled,
+			"cancelled_qty": gorm.Expr("quantity"),
+			"update_time":   time.Now(),
+		}).Error
+	return err
+}
+
+// FulfillOrderItemsTx mark every unit of an order that was not cancelled as fulfilled
+func (r *OrderRepository) FulfillOrderItemsTx(ctx context.Context, tx *gorm.DB, orderID int64) error {
+	err := tx.WithContext(ctx).Table("order_items").
+		Where("order_id = ? AND quantity > cancelled_qty", orderID).
+		Updates(map[string]interface{}{
+			"status":        constant.OrderItemStatusFulfilled,
+			"fulfilled_qty": gorm.Expr("quantity - cancelled_qty"),
+			"update_time":   time.Now(),
+		}).Error
+	return err
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"order_service/infra/constant"
+	"order_service/models"
+	"order_service/money"
+	"time"
+)
+
+// InsertOrderReturnTx insert a return and its items
+func (r *OrderRepository) InsertOrderReturnTx(ctx context.Context, tx *gorm.DB, orderReturn *models.OrderReturn, items []models.OrderReturnItem) error {
+	err := tx.WithContext(ctx).Table("order_return").Create(orderReturn).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range items {
+		items[i].ReturnID = orderReturn.ID
+	}
+	err = tx.WithContext(ctx).Table("order_return_item").Create(&items).Error
+	return err
+}
+
+// GetOrderReturnForUpdateTx get a return and lock it until the transaction ends
+func (r *OrderRepository) GetOrderReturnForUpdateTx(ctx context.Context, tx *gorm.DB, returnID int64) (*models.OrderReturn, error) {
+	var orderReturn models.OrderReturn
+	err := tx.WithContext(ctx).Table("order_return").
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", returnID).
+		First(&orderReturn).Error
+	if err != nil {
+		return nil, err
+	}
+	return &orderReturn, nil
+}
+
+// UpdateOrderReturnStatusTx update the status of a return, the review note is kept when note is empty
+func (r *OrderRepository) UpdateOrderReturnStatusTx(ctx context.Context, tx *gorm.DB, returnID int64, status int, note string) error {
+	updates := map[string]interface{}{
+		"status":      status,
+		"update_time": time.Now(),
+	}
+	if note != "" {
+		updates["review_note"] = note
+	}
+
+	err := tx.WithContext(ctx).Table("order_return").Where("id = ?", returnID).Updates(updates).Error
+	return err
+}
+
+// HasUserOrder tell whether the order exists and belongs to the user
+func (r *OrderRepository) HasUserOrder(ctx context.Context, orderID int64, userID int64) (bool, error) {
+	var count int64
+	err := r.Database.WithContext(ctx).Table("orders").
+		Where("id = ? AND user_id = ?", orderID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetOrderReturns get the returns of an order of the user, oldest first
+func (r *OrderRepository) GetOrderReturns(ctx context.Context, orderID int64, userID int64) ([]models.OrderReturn, error) {
+	var returns []models.OrderReturn
+	err := r.Database.WithContext(ctx).Table("order_return").
+		Where("order_id = ? AND user_id = ?", orderID, userID).
+		Order("id ASC").
+		Find(&returns).Error
+	if err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
+
+// GetOrderReturnItems get the items of the given returns
+func (r *OrderRepository) GetOrderReturnItems(ctx context.Context, returnIDs []int64) ([]models.OrderReturnItem, error) {
+	return r.getOrderReturnItems(r.Database.WithContext(ctx), returnIDs)
+}
+
+// GetOrderReturnItemsTx get the items of the given returns
+func (r *OrderRepository) GetOrderReturnItemsTx(ctx context.Context, tx *gorm.DB, returnIDs []int64) ([]models.OrderReturnItem, error) {
+	return r.getOrderReturnItems(tx.WithContext(ctx), returnIDs)
+}
+
+func (r *OrderRepository) getOrderReturnItems(db *gorm.DB, returnIDs []int64) ([]models.OrderReturnItem, error) {
+	var items []models.OrderReturnItem
+	err := db.Table("order_return_item").
+		Where("return_id IN ?", returnIDs).
+		Order("id ASC").
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetPendingReturnQtyTx sum, per order item, the quantity of the returns of an order that are
+// requested or approved but not received yet
+func (r *OrderRepository) GetPendingReturnQtyTx(ctx context.Context, tx *gorm.DB, orderID int64) (map[int64]int64, error) {
+	var rows []struct {
+		OrderItemID int64
+		Quantity    int64
+	}
+
+	err := tx.WithContext(ctx).Table("order_return_item ri").
+		Select("ri.order_item_id, SUM(ri.quantity) AS quantity").
+		Joins("JOIN order_return rt ON rt.id = ri.return_id").
+		Where("rt.order_id = ?", orderID).
+		Where("rt.status IN ?", []int{constant.ReturnStatusRequested, constant.ReturnStatusApproved}).
+		Group("ri.order_item_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		pending[row.OrderItemID] = row.Quantity
+	}
+	return pending, nil
+}
+
+// InsertOrderRefundTx insert refund
+func (r *OrderRepository) InsertOrderRefundTx(ctx context.Context, tx *gorm.DB, refund *models.OrderRefund) error {
+	err := tx.WithContext(ctx).Table("order_refund").Create(refund).Error
+	return err
+}
+
+// GetOrderRefundForUpdateTx get a refund and lock it until the transaction ends
+func (r *OrderRepository) GetOrderRefundForUpdateTx(ctx context.Context, tx *gorm.DB, refundID int64) (*models.OrderRefund, error) {
+	var refund models.OrderRefund
+	err := tx.WithContext(ctx).Table("order_refund").
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", refundID).
+		First(&refund).Error
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// UpdateOrderRefundStatusTx update the status of a refund, the failure reason is only kept when it failed
+func (r *OrderRepository) UpdateOrderRefundStatusTx(ctx context.Context, tx *gorm.DB, refundID int64, status int, failureReason string) error {
+	if status != constant.RefundStatusFailed {
+		failureReason = ""
+	}
+
+	err := tx.WithContext(ctx).Table("order_refund").
+		Where("id = ?", refundID).
+		Updates(map[string]interface{}{
+			"status":         status,
+			"failure_reason": failureReason,
+			"update_time":    time.Now(),
+		}).Error
+	return err
+}
+
+// RetryOrderRefundTx put a refund back to pending under a new attempt
+func (r *OrderRepository) RetryOrderRefundTx(ctx context.Context, tx *gorm.DB, refundID int64, attempt int) error {
+	err := tx.WithContext(ctx).Table("order_refund").
+		Where("id = ?", refundID).
+		Updates(map[string]interface{}{
+			"status":         constant.RefundStatusPending,
+			"attempt":        attempt,
+			"failure_reason": "",
+			"update_time":    time.Now(),
+		}).Error
+	return err
+}
+
+// GetOrderRefunds get the refunds of the given returns
+func (r *OrderRepository) GetOrderRefunds(ctx context.Context, returnIDs []int64) ([]models.OrderRefund, error) {
+	var refunds []models.OrderRefund
+	err := r.Database.WithContext(ctx).Table("order_refund").
+		Where("return_id IN ?", returnIDs).
+		Find(&refunds).Error
+	if err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// SumOrderRefundsTx sum the refunds of an order that did not fail
+func (r *OrderRepository) SumOrderRefundsTx(ctx context.Context, tx *gorm.DB, orderID int64) (money.Amount, error) {
+	var total money.Amount
+	err := tx.WithContext(ctx).Table("order_refund").
+		Select("COALESCE(SUM(amount), 0)").
+		Where("order_id = ? AND status <> ?", orderID, constant.RefundStatusFailed).
+		Scan(&total).Error
+	return total, err
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"order_service/config"
+	"order_service/infra/constant"
+	"order_service/money"
+	"os"
+)
+
+// FileRateProvider serve exchange rates from a static json file, a stand-in until a rate service is wired
+type FileRateProvider struct {
+	base  money.Currency
+	rates map[money.Currency]money.Rate
+}
+
+type rateFile struct {
+	Base  string                `json:"base"`
+	Rates map[string]money.Rate `json:"rates"`
+}
+
+func NewFileRateProvider(cfg config.CurrencyConfig) (*FileRateProvider, error) {
+	raw, err := os.ReadFile(cfg.RatesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var file rateFile
+	if err = json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("invalid rates file %s: %w", cfg.RatesFile, err)
+	}
+
+	base, err := money.ParseCurrency(file.Base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base currency in %s: %w", cfg.RatesFile, err)
+	}
+
+	provider := &FileRateProvider{
+		base:  base,
+		rates: make(map[money.Currency]money.Rate, len(file.Rates)),
+	}
+	for code, rate := range file.Rates {
+		currency, err := money.ParseCurrency(code)
+		if err != nil {
+			return nil, fmt.Errorf("invalid currency %q in %s: %w", code, cfg.RatesFile, err)
+		}
+		provider.rates[currency] = rate
+	}
+	return provider, nil
+}
+
+// Rate get the amount of quote bought by one unit of base
+func (p *FileRateProvider) Rate(ctx context.Context, base money.Currency, quote money.Currency) (money.Rate, error) {
+	if base == quote {
+		return money.IdentityRate, nil
+	}
+
+	rate, ok := p.rates[quote]
+	if base != p.base || !ok {
+		return 0, fmt.Errorf("%w: %s to %s", constant.ErrUnsupportedCurrency, base, quote)
+	}
+	return rate, nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"order_service/config"
+	"order_service/infra/constant"
+	"order_service/models"
+	"order_service/money"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileRateProvider(t *testing.T) {
+	provider, err := NewFileRateProvider(config.CurrencyConfig{Base: "IDR", RatesFile: "testdata/rates.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		base    money.Currency
+		quote   money.Currency
+		want    string
+		wantErr error
+	}{
+		{base: "IDR", quote: "USD", want: "0.00006150"},
+		{base: "IDR", quote: "SGD", want: "0.00008250"},
+		{base: "IDR", quote: "IDR", want: "1.00000000"},
+		{base: "USD", quote: "USD", want: "1.00000000"},
+		{base: "IDR", quote: "EUR", wantErr: constant.ErrUnsupportedCurrency},
+		{base: "USD", quote: "SGD", wantErr: constant.ErrUnsupportedCurrency}, // rates are only from the file base
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.base)+"-"+string(tt.quote), func(t *testing.T) {
+			rate, err := provider.Rate(context.Background(), tt.base, tt.quote)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Rate error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || rate.String() != tt.want {
+				t.Fatalf("Rate = %s, %v, want %s", rate, err, tt.want)
+			}
+		})
+	}
+
+	rate, _ := provider.Rate(context.Background(), "IDR", "USD")
+	converted, err := money.Convert(money.FromMinorUnits(15000000), rate) // 150000.00 IDR
+	if err != nil || converted.String() != "9.22" {                       // 9.225 rounds half to even
+		t.Fatalf("Convert = %s, %v, want 9.22", converted, err)
+	}
+}
+
+func TestFileRateProviderInvalidFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "not json", content: `base: IDR`},
+		{name: "invalid base", content: `{"base": "ID", "rates": {}}`},
+		{name: "invalid quote", content: `{"base": "IDR", "rates": {"US": "1"}}`},
+		{name: "currency without cents", content: `{"base": "IDR", "rates": {"JPY": "0.0095"}}`},
+		{name: "invalid rate", content: `{"base": "IDR", "rates": {"USD": "-1"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rates.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := NewFileRateProvider(config.CurrencyConfig{Base: "IDR", RatesFile: path}); err == nil {
+				t.Fatal("NewFileRateProvider succeeded, want an error")
+			}
+		})
+	}
+
+	if _, err := NewFileRateProvider(config.CurrencyConfig{Base: "IDR", RatesFile: "testdata/missing.json"}); err == nil {
+		t.Fatal("NewFileRateProvider succeeded on a missing file, want an error")
+	}
+}
+
+// TestOrderHistoryReportsSnapshotRate check the history shows the rate stored on the order
+func TestOrderHistoryReportsSnapshotRate(t *testing.T) {
+	rate, _ := money.ParseRate("0.0000615")
+	result := models.OrderHistoryResult{
+		ID:           7,
+		Amount:       money.FromMinorUnits(922),
+		Currency:     "USD",
+		BaseAmount:   money.FromMinorUnits(15000000),
+		BaseCurrency: "IDR",
+		ExchangeRate: rate,
+	}
+
+	response := toOrderHistoryResponse(result, nil, nil)
+	if response.ExchangeRate != rate || response.Currency != "USD" || response.BaseCurrency != "IDR" {
+		t.Fatalf("history = %s %s / %s, want rate %s", response.ExchangeRate, response.Currency, response.BaseCurrency, rate)
+	}
+	if response.TotalAmount != result.Amount || response.BaseAmount != result.BaseAmount {
+		t.Fatalf("history amounts = %s / %s, want %s / %s", response.TotalAmount, response.BaseAmount, result.Amount, result.BaseAmount)
+	}
+}
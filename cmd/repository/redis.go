@@ -1 +1,93 @@
 package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"order_service/models"
+	"time"
+)
+
+func productCacheKey(productId int64) string {
+	return fmt.Sprintf("order_service:product:%d", productId)
+}
+
+// GetProductsCache get cached products in one round trip, ids missing from the cache are left out of the result
+func (r *OrderRepository) GetProductsCache(ctx context.Context, productIds []int64) (map[int64]models.Product, error) {
+	products := make(map[int64]models.Product, len(productIds))
+	if len(productIds) == 0 {
+		return products, nil
+	}
+
+	keys := make([]string, 0, len(productIds))
+	for _, productId := range productIds {
+		keys = append(keys, productCacheKey(productId))
+	}
+
+	values, err := r.Redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return products, nil
+		}
+		return nil, err
+	}
+
+	for i, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var product models.Product
+		if err = json.Unmarshal([]byte(raw), &product); err != nil {
+			continue
+		}
+		products[productIds[i]] = product
+	}
+	return products, nil
+}
+
+// SetProductCache cache product info for ttl
+func (r *OrderRepository) SetProductCache(ctx context.Context, product models.Product, ttl time.Duration) error {
+	value, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+	return r.Redis.Set(ctx, productCacheKey(product.ID), value, ttl).Err()
+}
+
+// releaseLockScript delete the lock only when it still holds our value, so a request that outlived
+// its lock ttl doesn't release a lock acquired by another request in the meantime
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// refreshLockScript extend the ttl of the lock only when it still holds our value
+var refreshLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+func idempotencyLockKey(idempotencyKey string) string {
+	return fmt.Sprintf("order_service:idempotency:lock:%s", idempotencyKey)
+}
+
+// AcquireIdempotencyLock lock an idempotency token, it returns false when the token is already locked
+func (r *OrderRepository) AcquireIdempotencyLock(ctx context.Context, idempotencyKey string, owner string, ttl time.Duration) (bool, error) {
+	return r.Redis.SetNX(ctx, idempotencyLockKey(idempotencyKey), owner, ttl).Result()
+}
+
+// RefreshIdempotencyLock extend the lock of an idempotency token held by owner
+func (r *OrderRepository) RefreshIdempotencyLock(ctx context.Context, idempotencyKey string, owner string, ttl time.Duration) error {
+	return refreshLockScript.Run(ctx, r.Redis, []string{idempotencyLockKey(idempotencyKey)}, owner, ttl.Milliseconds()).Err()
+}
+
+// ReleaseIdempotencyLock unlock an idempotency token held by owner
+func (r *OrderRepository) ReleaseIdempotencyLock(ctx context.Context, idempotencyKey string, owner string) error {
+	return releaseLockScript.Run(ctx, r.Redis, []string{idempotencyLockKey(idempotencyKey)}, owner).Err()
+}
@@ -2,99 +2,107 @@ package repository
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
 	"gorm.io/gorm"
-	"io"
-	"net/http"
+	"order_service/config"
 	"order_service/infra/log"
 	"order_service/models"
+	"order_service/product"
+	"sync"
 )
 
 type OrderRepository struct {
-	Database    *gorm.DB
-	Redis       *redis.Client
-	ProductHost string
+	Database      *gorm.DB
+	Redis         *redis.Client
+	ProductClient *product.Client
+	ProductConfig config.ProductService
 }
 
-func NewOrderRepository(db *gorm.DB, redisClient *redis.Client, productHost string) *OrderRepository {
+func NewOrderRepository(db *gorm.DB, redisClient *redis.Client, productClient *product.Client, productConfig config.ProductService) *OrderRepository {
 	return &OrderRepository{
-		Database:    db,
-		Redis:       redisClient,
-		ProductHost: productHost,
+		Database:      db,
+		Redis:         redisClient,
+		ProductClient: productClient,
+		ProductConfig: productConfig,
 	}
 }
 
-func (r *OrderRepository) GetProductInfo(ctx context.Context, productId int64) (models.Product, error) {
-	var model models.Product
-
-	url := fmt.Sprintf("%s/v1/product/%d", r.ProductHost, productId)
-	log.Logger.Info(fmt.Sprintf("Requesting product info from %s", url))
-
-	// Create the HTTP request with the provided context
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		log.Logger.WithFields(logrus.Fields{
-			"productId": productId,
-			"url":       url,
-			"err":       err.Error(),
-		}).Error("Failed to create HTTP request")
-		return models.Product{}, err
+// GetProductsInfo get product info of every distinct id. Products are served from the redis cache
+// when possible, the rest are fetched from the product service with bounded concurrency and cached.
+// Products the product service doesn't know are left out of the result.
+func (r *OrderRepository) GetProductsInfo(ctx context.Context, productIds []int64) (map[int64]models.Product, error) {
+	seen := map[int64]bool{}
+	uniqueIds := make([]int64, 0, len(productIds))
+	for _, productId := range productIds {
+		if !seen[productId] {
+			seen[productId] = true
+			uniqueIds = append(uniqueIds, productId)
+		}
 	}
 
-	// Perform the HTTP request
-	resp, err := http.DefaultClient.Do(req)
+	products, err := r.GetProductsCache(ctx, uniqueIds)
 	if err != nil {
+		// the cache is an optimization, fall back to the product service
 		log.Logger.WithFields(logrus.Fields{
-			"productId": productId,
-			"url":       url,
-			"err":       err.Error(),
-		}).Error("Failed to execute HTTP request")
-		return models.Product{}, errors.New("failed to get product detail")
+			"err": err.Error(),
+		}).Warn("Failed to read product cache")
+		products = make(map[int64]models.Product, len(uniqueIds))
 	}
 
-	// Ensure the response body is closed once the function completes
-	defer func(Body io.ReadCloser) {
-		if err := Body.Close(); err != nil {
-			log.Logger.WithFields(logrus.Fields{
-				"productId": productId,
-				"err":       err.Error(),
-			}).Error("Failed to close response body")
+	var missingIds []int64
+	for _, productId := range uniqueIds {
+		if _, ok := products[productId]; !ok {
+			missingIds = append(missingIds, productId)
 		}
-	}(resp.Body)
+	}
 
-	// Check if the status code is OK (200)
-	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusNotFound {
-			return models.Product{}, nil
-		}
+	var mu sync.Mutex
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(r.ProductConfig.Concurrency)
+	for _, productId := range missingIds {
+		group.Go(func() error {
+			productInfo, err := r.GetProductInfo(groupCtx, productId)
+			if err != nil {
+				if errors.Is(err, product.ErrProductNotFound) {
+					return nil
+				}
+				return err
+			}
 
-		log.Logger.WithFields(logrus.Fields{
-			"productId":  productId,
-			"statusCode": resp.StatusCode,
-			"url":        url,
-		}).Error("Received non-200 HTTP status")
-		return models.Product{}, fmt.Errorf("invalid response, status code: %d", resp.StatusCode)
+			if err = r.SetProductCache(groupCtx, productInfo, r.ProductConfig.CacheTTL); err != nil {
+				log.Logger.WithFields(logrus.Fields{
+					"productId": productId,
+					"err":       err.Error(),
+				}).Warn("Failed to cache product info")
+			}
+
+			mu.Lock()
+			products[productId] = productInfo
+			mu.Unlock()
+			return nil
+		})
 	}
 
-	// Decode the response body into the model
-	var response models.GetProductInfo
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		log.Logger.WithFields(logrus.Fields{
-			"productId": productId,
-			"err":       err.Error(),
-		}).Error("Failed to decode response body")
+	if err = group.Wait(); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// GetProductInfo get product info from the product service
+func (r *OrderRepository) GetProductInfo(ctx context.Context, productId int64) (models.Product, error) {
+	productInfo, err := r.ProductClient.GetProduct(ctx, productId)
+	if err != nil {
 		return models.Product{}, err
 	}
-	model = response.Product
 
 	log.Logger.WithFields(logrus.Fields{
 		"productId": productId,
-		"product":   model,
+		"product":   productInfo,
 	}).Info("Successfully retrieved product info")
 
-	return model, nil
+	return productInfo, nil
 }
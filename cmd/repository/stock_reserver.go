@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"order_service/infra/constant"
+	"order_service/models"
+	"order_service/product"
+	"time"
+)
+
+// ProductStockReserver reserve stock through the product service reservation endpoints
+type ProductStockReserver struct {
+	ProductClient *product.Client
+}
+
+func NewProductStockReserver(productClient *product.Client) *ProductStockReserver {
+	return &ProductStockReserver{
+		ProductClient: productClient,
+	}
+}
+
+// Reserve hold stock for every item until ttl elapses or the reservation is confirmed or released
+func (r *ProductStockReserver) Reserve(ctx context.Context, reservationID string, items []models.CheckoutItem, ttl time.Duration) error {
+	request := models.StockReservationRequest{
+		ReservationID: reservationID,
+		TTLSeconds:    int64(ttl.Seconds()),
+	}
+	for _, item := range items {
+		request.Items = append(request.Items, models.StockReservationItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	err := r.ProductClient.Post(ctx, "/v1/product/reservations", request)
+	if isStatus(err, http.StatusConflict) {
+		return constant.ErrInsufficientStock
+	}
+	return err
+}
+
+// Confirm turn a reservation into a permanent stock deduction so it no longer expires
+func (r *ProductStockReserver) Confirm(ctx context.Context, reservationID string) error {
+	return r.ProductClient.Post(ctx, fmt.Sprintf("/v1/product/reservations/%s/confirm", reservationID), nil)
+}
+
+// Release give the reserved stock back to the product service.
+// A reservation the product service doesn't know has nothing left to release.
+func (r *ProductStockReserver) Release(ctx context.Context, reservationID string) error {
+	err := r.ProductClient.Post(ctx, fmt.Sprintf("/v1/product/reservations/%s/release", reservationID), nil)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ReleaseItems give part of a reservation back, the release id makes a retried release a no-op.
+// A reservation the product service doesn't know has nothing left to release.
+func (r *ProductStockReserver) ReleaseItems(ctx context.Context, reservationID string, releaseID string, items []models.StockReservationItem) error {
+	request := models.StockReleaseRequest{
+		ReleaseID: releaseID,
+		Items:     items,
+	}
+
+	err := r.ProductClient.Post(ctx, fmt.Sprintf("/v1/product/reservations/%s/release_items", reservationID), request)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+func isStatus(err error, statusCode int) bool {
+	var statusErr *product.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == statusCode
+}
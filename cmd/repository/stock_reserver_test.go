@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"order_service/infra/constant"
+	"order_service/infra/log"
+	"order_service/models"
+	"order_service/product"
+	"order_service/product/producttest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetupLogger()
+	os.Exit(m.Run())
+}
+
+func newTestStockReserver(t *testing.T) (*ProductStockReserver, *producttest.Server) {
+	server := producttest.NewServer()
+	t.Cleanup(server.Close)
+
+	server.AddProduct(models.Product{ID: 1, Name: "keyboard"}, 10)
+	server.AddProduct(models.Product{ID: 2, Name: "mouse"}, 5)
+	return NewProductStockReserver(product.NewClient(server.Config())), server
+}
+
+func TestProductStockReserverReserve(t *testing.T) {
+	reserver, server := newTestStockReserver(t)
+	ctx := context.Background()
+
+	items := []models.CheckoutItem{
+		{ProductID: 1, Quantity: 3},
+		{ProductID: 2, Quantity: 5},
+	}
+	if err := reserver.Reserve(ctx, "res-1", items, 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Stock(1) != 7 || server.Stock(2) != 0 {
+		t.Fatalf("stock = %d, %d, want 7, 0", server.Stock(1), server.Stock(2))
+	}
+	if reservation := server.Reservation("res-1"); reservation.TTLSeconds != 900 {
+		t.Fatalf("ttl = %d, want 900", reservation.TTLSeconds)
+	}
+
+	// retrying the same reservation id takes nothing more
+	if err := reserver.Reserve(ctx, "res-1", items, 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if server.Stock(1) != 7 {
+		t.Fatalf("stock after retry = %d, want 7", server.Stock(1))
+	}
+
+	err := reserver.Reserve(ctx, "res-2", []models.CheckoutItem{{ProductID: 2, Quantity: 1}}, time.Minute)
+	if !errors.Is(err, constant.ErrInsufficientStock) {
+		t.Fatalf("Reserve error = %v, want ErrInsufficientStock", err)
+	}
+}
+
+func TestProductStockReserverConfirmRelease(t *testing.T) {
+	reserver, server := newTestStockReserver(t)
+	ctx := context.Background()
+
+	if err := reserver.Reserve(ctx, "res-1", []models.CheckoutItem{{ProductID: 1, Quantity: 4}}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := reserver.Confirm(ctx, "res-1"); err != nil {
+		t.Fatal(err)
+	}
+	if status := server.Reservation("res-1").Status; status != producttest.ReservationConfirmed {
+		t.Fatalf("status = %s, want confirmed", status)
+	}
+
+	// part of the order is cancelled, then the rest
+	release := []models.StockReservationItem{{ProductID: 1, Quantity: 1}}
+	if err := reserver.ReleaseItems(ctx, "res-1", "rel-1", release); err != nil {
+		t.Fatal(err)
+	}
+	if err := reserver.ReleaseItems(ctx, "res-1", "rel-1", release); err != nil {
+		t.Fatal(err)
+	}
+	if server.Stock(1) != 7 {
+		t.Fatalf("stock after partial release = %d, want 7", server.Stock(1))
+	}
+
+	if err := reserver.Release(ctx, "res-1"); err != nil {
+		t.Fatal(err)
+	}
+	if server.Stock(1) != 10 {
+		t.Fatalf("stock after release = %d, want 10", server.Stock(1))
+	}
+
+	// an unknown reservation has nothing to release
+	if err := reserver.Release(ctx, "missing"); err != nil {
+		t.Fatalf("Release of unknown reservation = %v, want nil", err)
+	}
+	if err := reserver.ReleaseItems(ctx, "missing", "rel-2", release); err != nil {
+		t.Fatalf("ReleaseItems of unknown reservation = %v, want nil", err)
+	}
+}
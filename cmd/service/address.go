@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"order_service/infra/constant"
+	"order_service/models"
+)
+
+func (s *OrderService) GetUserAddresses(ctx context.Context, userID int64) ([]models.UserAddress, error) {
+	return s.OrderRepository.GetUserAddresses(ctx, userID)
+}
+
+// GetUserAddress get an address of the user's address book
+func (s *OrderService) GetUserAddress(ctx context.Context, userID int64, addressID int64) (*models.UserAddress, error) {
+	address, err := s.OrderRepository.GetUserAddress(ctx, userID, addressID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, constant.ErrAddressNotFound
+		}
+		return nil, err
+	}
+	return address, nil
+}
+
+// GetDefaultUserAddress get the default address of a user, nil when the user has none
+func (s *OrderService) GetDefaultUserAddress(ctx context.Context, userID int64) (*models.UserAddress, error) {
+	address, err := s.OrderRepository.GetDefaultUserAddress(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return address, nil
+}
+
+// SaveUserAddress add an address to the user's address book. The first address of a user is
+// always the default one, and a new default address takes the flag from the previous one.
+func (s *OrderService) SaveUserAddress(ctx context.Context, address *models.UserAddress) error {
+	return s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		addresses, err := s.OrderRepository.LockUserAddressesTx(ctx, tx, address.UserID)
+		if err != nil {
+			return err
+		}
+
+		if len(addresses) >= constant.MaxAddressesPerUser {
+			return constant.ErrAddressBookFull
+		}
+
+		if len(addresses) == 0 {
+			address.IsDefault = true
+		}
+
+		if address.IsDefault {
+			if err = s.OrderRepository.ClearDefaultUserAddressTx(ctx, tx, address.UserID); err != nil {
+				return err
+			}
+		}
+		err = s.OrderRepository.InsertUserAddressTx(ctx, tx, address)
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return constant.ErrAddressConflict
+		}
+		return err
+	})
+}
+
+// UpdateUserAddress update an address of the user's address book. The default flag can only be
+// moved to another address, not cleared, so a user with addresses always has a default one.
+func (s *OrderService) UpdateUserAddress(ctx context.Context, address *models.UserAddress) error {
+	return s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		addresses, err := s.OrderRepository.LockUserAddressesTx(ctx, tx, address.UserID)
+		if err != nil {
+			return err
+		}
+
+		current := findUserAddress(addresses, address.ID)
+		if current == nil {
+			return constant.ErrAddressNotFound
+		}
+
+		if current.IsDefault {
+			address.IsDefault = true
+		} else if address.IsDefault {
+			if err = s.OrderRepository.ClearDefaultUserAddressTx(ctx, tx, address.UserID); err != nil {
+				return err
+			}
+		}
+
+		address.CreateTime = current.CreateTime
+		return s.OrderRepository.UpdateUserAddressTx(ctx, tx, address)
+	})
+}
+
+// DeleteUserAddress delete an address of the user's address book. Orders keep their own copy of
+// the address. When the default address is deleted the newest remaining one becomes the default.
+func (s *OrderService) DeleteUserAddress(ctx context.Context, userID int64, addressID int64) error {
+	return s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		addresses, err := s.OrderRepository.LockUserAddressesTx(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		current := findUserAddress(addresses, addressID)
+		if current == nil {
+			return constant.ErrAddressNotFound
+		}
+
+		if err = s.OrderRepository.DeleteUserAddressTx(ctx, tx, userID, addressID); err != nil {
+			return err
+		}
+
+		if !current.IsDefault {
+			return nil
+		}
+
+		for _, address := range addresses {
+			if address.ID != addressID {
+				return s.OrderRepository.SetDefaultUserAddressTx(ctx, tx, userID, address.ID)
+			}
+		}
+		return nil
+	})
+}
+
+func findUserAddress(addresses []models.UserAddress, addressID int64) *models.UserAddress {
+	for i := range addresses {
+		if addresses[i].ID == addressID {
+			return &addresses[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"order_service/infra/constant"
+	"order_service/models"
+	"time"
+)
+
+// GetCouponsByCodes get the coupons of the given codes keyed by code
+func (s *OrderService) GetCouponsByCodes(ctx context.Context, codes []string) (map[string]models.Coupon, error) {
+	coupons, err := s.OrderRepository.GetCouponsByCodes(ctx, codes)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]models.Coupon, len(coupons))
+	for _, coupon := range coupons {
+		result[coupon.Code] = coupon
+	}
+	return result, nil
+}
+
+func (s *OrderService) CountCouponUsage(ctx context.Context, couponID int64, userID int64) (int64, error) {
+	return s.OrderRepository.CountCouponUsage(ctx, couponID, userID)
+}
+
+// recordCouponUsageTx record the coupons used by an order. The coupon row is locked while its
+// usage is counted so concurrent checkouts of the same user can't go past the per-user limit.
+func (s *OrderService) recordCouponUsageTx(ctx context.Context, tx *gorm.DB, order *models.Order, discounts []models.AppliedDiscount) error {
+	for _, discount := range discounts {
+		coupon, err := s.OrderRepository.GetCouponForUpdateTx(ctx, tx, discount.CouponID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return constant.ErrCouponNotFound
+			}
+			return err
+		}
+
+		if coupon.MaxUsesPerUser > 0 {
+			used, err := s.OrderRepository.CountCouponUsageTx(ctx, tx, coupon.ID, order.UserID)
+			if err != nil {
+				return err
+			}
+
+			if used >= int64(coupon.MaxUsesPerUser) {
+				return constant.ErrCouponUsageExceeded
+			}
+		}
+
+		err = s.OrderRepository.InsertCouponUsageTx(ctx, tx, &models.CouponUsage{
+			CouponID:   coupon.ID,
+			UserID:     order.UserID,
+			OrderID:    order.ID,
+			CreateTime: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
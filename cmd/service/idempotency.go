@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"order_service/infra/constant"
+	"order_service/models"
+	"time"
+)
+
+// BeginIdempotentRequest register the idempotency key of a request as in progress.
+// It returns nil when the request owns the key and should run, or the existing key
+// when the user already used it. A key whose lock expired, its request died, is taken over.
+func (s *OrderService) BeginIdempotentRequest(ctx context.Context, record *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	inserted, err := s.OrderRepository.InsertIdempotencyKey(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+
+	if inserted {
+		return nil, nil
+	}
+
+	existing, err := s.OrderRepository.GetIdempotencyKey(ctx, record.UserID, record.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.Status == constant.IdempotencyStatusInProgress {
+		record.ID = existing.ID
+		claimed, err := s.OrderRepository.ClaimStaleIdempotencyKey(ctx, record, time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		if claimed {
+			return nil, nil
+		}
+	}
+	return existing, nil
+}
+
+// RefreshIdempotentRequest extend the lock of a running request so a retry doesn't take its key over
+func (s *OrderService) RefreshIdempotentRequest(ctx context.Context, id int64, lockExpireTime time.Time) error {
+	return s.OrderRepository.RefreshIdempotencyKeyLock(ctx, id, lockExpireTime)
+}
+
+// CompleteIdempotentRequest store the response replayed for later requests with the same key
+func (s *OrderService) CompleteIdempotentRequest(ctx context.Context, id int64, responseStatus int, responseBody string) error {
+	return s.OrderRepository.CompleteIdempotencyKey(ctx, id, responseStatus, responseBody)
+}
+
+// AbortIdempotentRequest free the key of a request that failed so the client can retry it
+func (s *OrderService) AbortIdempotentRequest(ctx context.Context, id int64) error {
+	return s.OrderRepository.DeleteIdempotencyKey(ctx, id)
+}
+
+// PurgeIdempotency delete expired idempotency keys and the checkout request logs older than
+// requestLogRetention. It returns the number of deleted rows.
+func (s *OrderService) PurgeIdempotency(ctx context.Context, requestLogRetention time.Duration, batchSize int) (int64, error) {
+	now := time.Now()
+
+	keys, err := s.OrderRepository.DeleteExpiredIdempotencyKeys(ctx, now, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	logs, err := s.OrderRepository.DeleteOrderRequestLogsBefore(ctx, now.Add(-requestLogRetention), batchSize)
+	if err != nil {
+		return keys, err
+	}
+	return keys + logs, nil
+}
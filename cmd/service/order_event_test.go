@@ -0,0 +1,70 @@
+package service
+
+import (
+	"order_service/models"
+	"order_service/money"
+	"testing"
+)
+
+func snapshotOrder(t *testing.T) *models.Order {
+	t.Helper()
+	rate, err := money.ParseRate("0.0000615")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &models.Order{
+		ID:           7,
+		UserID:       3,
+		Amount:       money.FromMinorUnits(922),
+		Currency:     "USD",
+		Subtotal:     money.FromMinorUnits(922),
+		BaseAmount:   money.FromMinorUnits(15000000),
+		BaseCurrency: "IDR",
+		ExchangeRate: rate,
+	}
+}
+
+// TestOrderEventsReportSnapshotRate check the events carry the rate stored on the order, not a current one
+func TestOrderEventsReportSnapshotRate(t *testing.T) {
+	order := snapshotOrder(t)
+
+	created := orderCreatedEvent(order.ID, order, &models.OrderDetail{})
+	if created.ExchangeRate != order.ExchangeRate || created.Currency != "USD" || created.BaseCurrency != "IDR" {
+		t.Fatalf("order.created rate = %s %s / %s, want %s", created.ExchangeRate, created.Currency, created.BaseCurrency, order.ExchangeRate)
+	}
+	if created.TotalAmount != order.Amount || created.BaseAmount != order.BaseAmount || created.PriceBreakdown.GrandTotal != order.Amount {
+		t.Fatalf("order.created amounts = %s / %s, want %s / %s", created.TotalAmount, created.BaseAmount, order.Amount, order.BaseAmount)
+	}
+
+	items := []models.OrderItem{
+		{ProductID: 1, Quantity: 2, CancelledQty: 1, UnitPrice: money.FromMinorUnits(461)},
+		{ProductID: 2, Quantity: 1, CancelledQty: 1, UnitPrice: money.FromMinorUnits(100)},
+	}
+	cancelled := orderCancelledEvent(order, items, "changed my mind")
+	if cancelled.ExchangeRate != order.ExchangeRate || cancelled.TotalAmount != order.Amount {
+		t.Fatalf("order.cancelled rate = %s amount = %s, want %s / %s", cancelled.ExchangeRate, cancelled.TotalAmount, order.ExchangeRate, order.Amount)
+	}
+	if len(cancelled.Items) != 1 || cancelled.Items[0].ProductID != 1 || cancelled.Items[0].Quantity != 1 {
+		t.Fatalf("order.cancelled items = %+v, want only the open unit of product 1", cancelled.Items)
+	}
+}
+
+// TestRefundRequestedEvent check a retried refund is published with its attempt and only its returned items
+func TestRefundRequestedEvent(t *testing.T) {
+	order := snapshotOrder(t)
+	refund := &models.OrderRefund{ID: 5, ReturnID: 9, Attempt: 2, Amount: money.FromMinorUnits(461), Currency: "USD"}
+	orderItems := []models.OrderItem{
+		{ID: 11, ProductID: 1, Quantity: 2, UnitPrice: money.FromMinorUnits(461)},
+		{ID: 12, ProductID: 2, Quantity: 1, UnitPrice: money.FromMinorUnits(100)},
+	}
+	returnItems := []models.OrderReturnItem{{ReturnID: 9, OrderItemID: 11, Quantity: 1}}
+
+	event := refundRequestedEvent(refund, order, orderItems, returnItems)
+	if event.RefundID != 5 || event.Attempt != 2 || event.ReturnID != 9 || event.ExchangeRate != order.ExchangeRate {
+		t.Fatalf("order.refund_requested = %+v, want refund 5 attempt 2 of return 9", event)
+	}
+	if len(event.Items) != 1 || event.Items[0].ProductID != 1 || event.Items[0].Quantity != 1 {
+		t.Fatalf("order.refund_requested items = %+v, want one unit of product 1", event.Items)
+	}
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"order_service/infra/constant"
+	"order_service/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CancelOrderItems cancel part of an order. The order row is locked for the whole transaction and
+// apply is called with the order, its items and its discounts: it records the cancelled quantities
+// on the items and returns the new price of the order. The items, the order amounts, the history,
+// the stock release of the cancelled units and the order.items_cancelled event are then written in
+// the same transaction. The returned release is pending, the caller applies it.
+func (s *OrderService) CancelOrderItems(ctx context.Context, param *models.OrderItemCancelParam, apply func(order *models.Order, items []models.OrderItem, discounts []models.AppliedDiscount) (*models.CheckoutQuote, error)) (*models.Order, *models.StockItemRelease, error) {
+	var updatedOrder *models.Order
+	var release *models.StockItemRelease
+
+	err := s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		order, err := s.OrderRepository.GetOrderForUpdateTx(ctx, tx, param.OrderID, param.UserID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return constant.ErrOrderNotFound
+			}
+			return err
+		}
+
+		orderDetail, err := s.OrderRepository.GetOrderDetailTx(ctx, tx, order.OrderDetailID)
+		if err != nil {
+			return err
+		}
+
+		items, err := s.OrderRepository.GetOrderItemsTx(ctx, tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		cancelledBefore := make(map[int64]int64, len(items))
+		for _, item := range items {
+			cancelledBefore[item.ID] = item.CancelledQty
+		}
+
+		quote, err := apply(order, items, orderDetail.Discounts)
+		if err != nil {
+			return err
+		}
+
+		var cancelledItems []models.OrderEventItem
+		var releasedItems []models.StockReservationItem
+		var cancelledItemIDs []int64
+		var cancelledQty int64
+		for i := range items {
+			item := &items[i]
+			qty := item.CancelledQty - cancelledBefore[item.ID]
+			if qty == 0 {
+				continue
+			}
+
+			if err = s.OrderRepository.UpdateOrderItemQtyTx(ctx, tx, item); err != nil {
+				return err
+			}
+
+			cancelledQty += qty
+			cancelledItemIDs = append(cancelledItemIDs, item.ID)
+			cancelledItems = append(cancelledItems, models.OrderEventItem{
+				ProductID: item.ProductID,
+				Quantity:  qty,
+				Price:     item.UnitPrice,
+			})
+			releasedItems = append(releasedItems, models.StockReservationItem{
+				ProductID: item.ProductID,
+				Quantity:  qty,
+			})
+		}
+
+		version, err := s.OrderRepository.CountStockItemReleasesTx(ctx, tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		release = &models.StockItemRelease{
+			ReleaseID:  stockItemReleaseID(order.ID, cancelledItemIDs, version+1),
+			OrderID:    order.ID,
+			Items:      releasedItems,
+			Status:     constant.StockItemReleaseStatusPending,
+			CreateTime: now,
+			UpdateTime: now,
+		}
+		if err = s.OrderRepository.InsertStockItemReleaseTx(ctx, tx, release); err != nil {
+			return err
+		}
+
+		previousAmount := order.Amount
+		order.Amount = quote.Pricing.GrandTotal
+		order.Subtotal = quote.Pricing.Subtotal
+		order.DiscountAmount = quote.Pricing.Discount
+		order.ShippingFee = quote.Pricing.ShippingFee
+		order.TaxAmount = quote.Pricing.Tax
+		order.BaseAmount = quote.BasePricing.GrandTotal
+		order.TotalQty -= int(cancelledQty)
+		if err = s.OrderRepository.UpdateOrderPricingTx(ctx, tx, order); err != nil {
+			return err
+		}
+
+		err = s.OrderRepository.UpdateOrderDiscountsTx(ctx, tx, order.OrderDetailID, quote.Discounts)
+		if err != nil {
+			return err
+		}
+
+		err = s.appendOrderHistoryTx(ctx, tx, order.ID, constant.OrderStatusTranslated[order.Status], fmt.Sprintf("%d item(s) cancelled: %s", cancelledQty, param.Reason))
+		if err != nil {
+			return err
+		}
+
+		// Queue Kafka event so payment adjusts the charge, the stock comes back through the release above
+		err = s.insertOutboxTx(ctx, tx, order.ID, constant.TopicItemsCancelled, models.OrderItemsCancelledEvent{
+			OrderID:        order.ID,
+			UserID:         order.UserID,
+			Reason:         param.Reason,
+			Items:          cancelledItems,
+			PreviousAmount: previousAmount,
+			TotalAmount:    order.Amount,
+			Currency:       order.Currency,
+			BaseAmount:     order.BaseAmount,
+			BaseCurrency:   order.BaseCurrency,
+			ExchangeRate:   order.ExchangeRate,
+			PriceBreakdown: quote.Pricing,
+			PaymentMethod:  order.PaymentMethod,
+			CancelTime:     now,
+		})
+		if err != nil {
+			return err
+		}
+
+		updatedOrder = order
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return updatedOrder, release, nil
+}
+
+// stockItemReleaseID derive the id of a partial stock release from the order, its cancelled items
+// and the number of releases of the order, the product service applies a release id once
+func stockItemReleaseID(orderID int64, itemIDs []int64, version int64) string {
+	ids := make([]string, 0, len(itemIDs))
+	for _, id := range itemIDs {
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+	return fmt.Sprintf("order-%d-items-%s-v%d", orderID, strings.Join(ids, "_"), version)
+}
+
+// GetOrderItems get the line items of an order
+func (s *OrderService) GetOrderItems(ctx context.Context, orderID int64) ([]models.OrderItem, error) {
+	return s.OrderRepository.GetOrderItems(ctx, orderID)
+}
+
+// orderItemsFromCheckout build the line items of an order from its checkout items
+func orderItemsFromCheckout(orderID int64, checkoutItems []models.CheckoutItem) []models.OrderItem {
+	items := make([]models.OrderItem, 0, len(checkoutItems))
+	for _, item := range checkoutItems {
+		items = append(items, models.OrderItem{
+			OrderID:       orderID,
+			ProductID:     item.ProductID,
+			Quantity:      item.Quantity,
+			UnitPrice:     item.Price,
+			BaseUnitPrice: item.BasePrice,
+			Weight:        item.Weight,
+			Status:        constant.OrderItemStatusActive,
+		})
+	}
+	return items
+}
@@ -0,0 +1,418 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"order_service/infra/constant"
+	"order_service/models"
+	"order_service/money"
+	"time"
+)
+
+// CreateOrderReturn open a return for items of an order. The order row is locked for the whole
+// transaction and check is called with the order, its items and the quantity per item already in
+// an open return, so the caller can reject the return before anything is written.
+func (s *OrderService) CreateOrderReturn(ctx context.Context, param *models.OrderReturnParam, check func(order *models.Order, items []models.OrderItem, pendingQty map[int64]int64) error) (*models.OrderReturn, error) {
+	var orderReturn *models.OrderReturn
+
+	err := s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		order, err := s.OrderRepository.GetOrderForUpdateTx(ctx, tx, param.OrderID, param.UserID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return constant.ErrOrderNotFound
+			}
+			return err
+		}
+
+		items, err := s.OrderRepository.GetOrderItemsTx(ctx, tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		pendingQty, err := s.OrderRepository.GetPendingReturnQtyTx(ctx, tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		if err = check(order, items, pendingQty); err != nil {
+			return err
+		}
+
+		returnItems := make([]models.OrderReturnItem, 0, len(param.Items))
+		for _, item := range param.Items {
+			returnItems = append(returnItems, models.OrderReturnItem{
+				OrderItemID: item.ItemID,
+				Quantity:    item.Quantity,
+			})
+		}
+
+		orderReturn = &models.OrderReturn{
+			OrderID: order.ID,
+			UserID:  order.UserID,
+			Status:  constant.ReturnStatusRequested,
+			Reason:  param.Reason,
+		}
+		err = s.OrderRepository.InsertOrderReturnTx(ctx, tx, orderReturn, returnItems)
+		if err != nil {
+			return err
+		}
+
+		return s.appendOrderHistoryTx(ctx, tx, order.ID, "return_"+constant.ReturnStatusTranslated[orderReturn.Status], param.Reason)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return orderReturn, nil
+}
+
+// ReviewOrderReturn move a return to the status of param. The return row is locked for the whole
+// transaction and check is called with the current return.
+func (s *OrderService) ReviewOrderReturn(ctx context.Context, param *models.ReturnReviewParam, check func(orderReturn *models.OrderReturn) error) (*models.OrderReturn, error) {
+	var updatedReturn *models.OrderReturn
+
+	err := s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		orderReturn, err := s.getOrderReturnForUpdateTx(ctx, tx, param.ReturnID)
+		if err != nil {
+			return err
+		}
+
+		if err = check(orderReturn); err != nil {
+			return err
+		}
+
+		err = s.OrderRepository.UpdateOrderReturnStatusTx(ctx, tx, orderReturn.ID, param.Status, param.Note)
+		if err != nil {
+			return err
+		}
+
+		err = s.appendOrderHistoryTx(ctx, tx, orderReturn.OrderID, "return_"+constant.ReturnStatusTranslated[param.Status], param.Note)
+		if err != nil {
+			return err
+		}
+
+		orderReturn.Status = param.Status
+		if param.Note != "" {
+			orderReturn.ReviewNote = param.Note
+		}
+		updatedReturn = orderReturn
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedReturn, nil
+}
+
+// ReceiveOrderReturn mark the items of a return as received and create its refund. The return and
+// the order rows are locked for the whole transaction and price is called with them, the order
+// items, the returned items and the amount already refunded on the order: it validates the return
+// and prices the refund. The refund is published as order.refund_requested.
+func (s *OrderService) ReceiveOrderReturn(ctx context.Context, returnID int64, price func(orderReturn *models.OrderReturn, order *models.Order, orderItems []models.OrderItem, returnItems []models.OrderReturnItem, refunded money.Amount) (*models.OrderRefund, error)) (*models.OrderRefund, error) {
+	var refund *models.OrderRefund
+
+	err := s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		orderReturn, err := s.getOrderReturnForUpdateTx(ctx, tx, returnID)
+		if err != nil {
+			return err
+		}
+
+		order, err := s.OrderRepository.GetOrderForUpdateTx(ctx, tx, orderReturn.OrderID, 0)
+		if err != nil {
+			return err
+		}
+
+		orderItems, err := s.OrderRepository.GetOrderItemsTx(ctx, tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		returnItems, err := s.OrderRepository.GetOrderReturnItemsTx(ctx, tx, []int64{orderReturn.ID})
+		if err != nil {
+			return err
+		}
+
+		refunded, err := s.OrderRepository.SumOrderRefundsTx(ctx, tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		refund, err = price(orderReturn, order, orderItems, returnItems, refunded)
+		if err != nil {
+			return err
+		}
+
+		returnedQty := make(map[int64]int64, len(returnItems))
+		for _, returnItem := range returnItems {
+			returnedQty[returnItem.OrderItemID] += returnItem.Quantity
+		}
+
+		for i := range orderItems {
+			item := &orderItems[i]
+			qty := returnedQty[item.ID]
+			if qty == 0 {
+				continue
+			}
+
+			item.RefundedQty += qty
+			if item.RefundedQty == item.FulfilledQty {
+				item.Status = constant.OrderItemStatusRefunded
+			}
+			if err = s.OrderRepository.UpdateOrderItemQtyTx(ctx, tx, item); err != nil {
+				return err
+			}
+		}
+
+		err = s.OrderRepository.UpdateOrderReturnStatusTx(ctx, tx, orderReturn.ID, constant.ReturnStatusReceived, "")
+		if err != nil {
+			return err
+		}
+
+		if err = s.OrderRepository.InsertOrderRefundTx(ctx, tx, refund); err != nil {
+			return err
+		}
+
+		err = s.appendOrderHistoryTx(ctx, tx, order.ID, "return_"+constant.ReturnStatusTranslated[constant.ReturnStatusReceived], "")
+		if err != nil {
+			return err
+		}
+
+		err = s.appendOrderHistoryTx(ctx, tx, order.ID, "refund_"+constant.RefundStatusTranslated[refund.Status], refund.Amount.String()+" "+string(refund.Currency))
+		if err != nil {
+			return err
+		}
+
+		// Queue Kafka event so payment pays the refund back
+		return s.insertOutboxTx(ctx, tx, order.ID, constant.TopicRefundRequest, refundRequestedEvent(refund, order, orderItems, returnItems))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// RetryOrderRefund request a failed refund again. The refund and the order rows are locked for the
+// whole transaction and check is called with them and the amount refunded by the other refunds of
+// the order. The refund goes back to pending under a new attempt and is published again as
+// order.refund_requested.
+func (s *OrderService) RetryOrderRefund(ctx context.Context, refundID int64, check func(refund *models.OrderRefund, order *models.Order, refunded money.Amount) error) (*models.OrderRefund, error) {
+	var retried *models.OrderRefund
+
+	err := s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		refund, err := s.OrderRepository.GetOrderRefundForUpdateTx(ctx, tx, refundID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return constant.ErrRefundNotFound
+			}
+			return err
+		}
+
+		order, err := s.OrderRepository.GetOrderForUpdateTx(ctx, tx, refund.OrderID, 0)
+		if err != nil {
+			return err
+		}
+
+		refunded, err := s.OrderRepository.SumOrderRefundsTx(ctx, tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		if err = check(refund, order, refunded); err != nil {
+			return err
+		}
+
+		refund.Attempt++
+		refund.Status = constant.RefundStatusPending
+		refund.FailureReason = ""
+		if err = s.OrderRepository.RetryOrderRefundTx(ctx, tx, refund.ID, refund.Attempt); err != nil {
+			return err
+		}
+
+		err = s.appendOrderHistoryTx(ctx, tx, order.ID, "refund_"+constant.RefundStatusTranslated[refund.Status], fmt.Sprintf("attempt %d", refund.Attempt))
+		if err != nil {
+			return err
+		}
+
+		orderItems, err := s.OrderRepository.GetOrderItemsTx(ctx, tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		returnItems, err := s.OrderRepository.GetOrderReturnItemsTx(ctx, tx, []int64{refund.ReturnID})
+		if err != nil {
+			return err
+		}
+
+		retried = refund
+		return s.insertOutboxTx(ctx, tx, order.ID, constant.TopicRefundRequest, refundRequestedEvent(refund, order, orderItems, returnItems))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return retried, nil
+}
+
+// refundRequestedEvent build the order.refund_requested event of a refund and its returned items
+func refundRequestedEvent(refund *models.OrderRefund, order *models.Order, orderItems []models.OrderItem, returnItems []models.OrderReturnItem) models.OrderRefundRequestedEvent {
+	returnedQty := make(map[int64]int64, len(returnItems))
+	for _, returnItem := range returnItems {
+		returnedQty[returnItem.OrderItemID] += returnItem.Quantity
+	}
+
+	var items []models.OrderEventItem
+	for _, item := range orderItems {
+		if qty := returnedQty[item.ID]; qty > 0 {
+			items = append(items, models.OrderEventItem{
+				ProductID: item.ProductID,
+				Quantity:  qty,
+				Price:     item.UnitPrice,
+			})
+		}
+	}
+
+	return models.OrderRefundRequestedEvent{
+		RefundID:       refund.ID,
+		Attempt:        refund.Attempt,
+		ReturnID:       refund.ReturnID,
+		OrderID:        order.ID,
+		UserID:         order.UserID,
+		Items:          items,
+		Subtotal:       refund.Subtotal,
+		DiscountAmount: refund.DiscountAmount,
+		TaxAmount:      refund.TaxAmount,
+		Amount:         refund.Amount,
+		Currency:       refund.Currency,
+		BaseAmount:     refund.BaseAmount,
+		BaseCurrency:   refund.BaseCurrency,
+		ExchangeRate:   order.ExchangeRate,
+		PaymentMethod:  order.PaymentMethod,
+		RequestTime:    time.Now(),
+	}
+}
+
+// ApplyRefundResult move a pending refund to the completed or failed status of a refund result event.
+// When eventKey was already processed, the result is of an earlier attempt, or the refund is no
+// longer pending, nothing is written. The reason is only kept for a failed refund.
+func (s *OrderService) ApplyRefundResult(ctx context.Context, refundID int64, attempt int, status int, reason string, eventKey string) error {
+	return s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		refund, err := s.OrderRepository.GetOrderRefundForUpdateTx(ctx, tx, refundID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return constant.ErrRefundNotFound
+			}
+			return err
+		}
+
+		isNew, err := s.OrderRepository.SaveProcessedEventTx(ctx, tx, eventKey, refund.OrderID)
+		if err != nil || !isNew {
+			return err
+		}
+
+		if refund.Status != constant.RefundStatusPending || refund.Attempt != attempt {
+			return nil
+		}
+
+		if status != constant.RefundStatusFailed {
+			reason = ""
+		}
+
+		err = s.OrderRepository.UpdateOrderRefundStatusTx(ctx, tx, refund.ID, status, reason)
+		if err != nil {
+			return err
+		}
+
+		return s.appendOrderHistoryTx(ctx, tx, refund.OrderID, "refund_"+constant.RefundStatusTranslated[status], reason)
+	})
+}
+
+// GetOrderReturns get the returns of an order of the user with their items and refunds, an order
+// of another user is not found
+func (s *OrderService) GetOrderReturns(ctx context.Context, orderID int64, userID int64) ([]models.OrderReturnResponse, error) {
+	found, err := s.OrderRepository.HasUserOrder(ctx, orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, constant.ErrOrderNotFound
+	}
+
+	returns, err := s.OrderRepository.GetOrderReturns(ctx, orderID, userID)
+	if err != nil || len(returns) == 0 {
+		return []models.OrderReturnResponse{}, err
+	}
+
+	returnIDs := make([]int64, 0, len(returns))
+	for _, orderReturn := range returns {
+		returnIDs = append(returnIDs, orderReturn.ID)
+	}
+
+	items, err := s.OrderRepository.GetOrderReturnItems(ctx, returnIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	refunds, err := s.OrderRepository.GetOrderRefunds(ctx, returnIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	itemsOfReturn := make(map[int64][]models.OrderReturnItemRequest, len(returns))
+	for _, item := range items {
+		itemsOfReturn[item.ReturnID] = append(itemsOfReturn[item.ReturnID], models.OrderReturnItemRequest{
+			ItemID:   item.OrderItemID,
+			Quantity: item.Quantity,
+		})
+	}
+
+	refundOfReturn := make(map[int64]*models.OrderRefundResponse, len(refunds))
+	for _, refund := range refunds {
+		refundOfReturn[refund.ReturnID] = &models.OrderRefundResponse{
+			RefundID:       refund.ID,
+			Status:         constant.RefundStatusTranslated[refund.Status],
+			Subtotal:       refund.Subtotal,
+			DiscountAmount: refund.DiscountAmount,
+			TaxAmount:      refund.TaxAmount,
+			Amount:         refund.Amount,
+			Currency:       refund.Currency,
+			Attempt:        refund.Attempt,
+			FailureReason:  refund.FailureReason,
+		}
+	}
+
+	responses := make([]models.OrderReturnResponse, 0, len(returns))
+	for _, orderReturn := range returns {
+		responses = append(responses, models.OrderReturnResponse{
+			ReturnID:   orderReturn.ID,
+			OrderID:    orderReturn.OrderID,
+			Status:     constant.ReturnStatusTranslated[orderReturn.Status],
+			Reason:     orderReturn.Reason,
+			ReviewNote: orderReturn.ReviewNote,
+			Items:      itemsOfReturn[orderReturn.ID],
+			Refund:     refundOfReturn[orderReturn.ID],
+			CreateTime: orderReturn.CreateTime,
+			UpdateTime: orderReturn.UpdateTime,
+		})
+	}
+	return responses, nil
+}
+
+func (s *OrderService) getOrderReturnForUpdateTx(ctx context.Context, tx *gorm.DB, returnID int64) (*models.OrderReturn, error) {
+	orderReturn, err := s.OrderRepository.GetOrderReturnForUpdateTx(ctx, tx, returnID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, constant.ErrReturnNotFound
+		}
+		return nil, err
+	}
+	return orderReturn, nil
+}
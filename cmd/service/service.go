@@ -2,12 +2,16 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	"order_service/cmd/repository"
+	"order_service/infra/constant"
 	"order_service/infra/log"
-	"order_service/kafka"
 	"order_service/models"
+	"time"
 )
 
 type OrderService struct {
@@ -20,17 +24,33 @@ func NewOrderService(orderRepo repository.OrderRepository) *OrderService {
 	}
 }
 
-// CheckIdempotency check idempotency
-func (s *OrderService) CheckIdempotency(ctx context.Context, idempotencyKey string) (bool, error) {
-	isExists, err := s.OrderRepository.CheckIdempotency(ctx, idempotencyKey)
+// GetIdempotency get the request log of an idempotency token of a user, nil when the user never used the token
+func (s *OrderService) GetIdempotency(ctx context.Context, userID int64, idempotencyKey string) (*models.OrderRequestLog, error) {
+	reqLog, err := s.OrderRepository.GetIdempotency(ctx, userID, idempotencyKey)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
 		log.Logger.WithFields(logrus.Fields{
-			"message": "error occurred on s.OrderRepository.CheckIdempotency",
+			"message": "error occurred on s.OrderRepository.GetIdempotency",
 			"error":   err,
 		})
-		return false, err
+		return nil, err
 	}
-	return isExists, nil
+	return reqLog, nil
+}
+
+func (s *OrderService) AcquireIdempotencyLock(ctx context.Context, idempotencyKey string, owner string, ttl time.Duration) (bool, error) {
+	return s.OrderRepository.AcquireIdempotencyLock(ctx, idempotencyKey, owner, ttl)
+}
+
+func (s *OrderService) RefreshIdempotencyLock(ctx context.Context, idempotencyKey string, owner string, ttl time.Duration) error {
+	return s.OrderRepository.RefreshIdempotencyLock(ctx, idempotencyKey, owner, ttl)
+}
+
+func (s *OrderService) ReleaseIdempotencyLock(ctx context.Context, idempotencyKey string, owner string) error {
+	return s.OrderRepository.ReleaseIdempotencyLock(ctx, idempotencyKey, owner)
 }
 
 // SaveIdempotency save idempotency
@@ -42,8 +62,9 @@ func (s *OrderService) CheckIdempotency(ctx context.Context, idempotencyKey stri
 //	return nil
 //}
 
-// SaveOrderAndOrderDetail save order and order_detail
-func (s *OrderService) SaveOrderAndOrderDetail(ctx context.Context, order *models.Order, orderDetail *models.OrderDetail, idempotencyToken string, producer kafka.KafkaProducer) (int64, error) {
+// SaveOrderAndOrderDetail save order and order_detail.
+// The order.created event is written to the outbox in the same transaction and published later by the outbox relay.
+func (s *OrderService) SaveOrderAndOrderDetail(ctx context.Context, order *models.Order, orderDetail *models.OrderDetail, items []models.CheckoutItem, requestLog *models.OrderRequestLog, reservationID string) (int64, error) {
 	var orderID int64
 
 	// Start a transaction for saving the order and its details
@@ -63,22 +84,45 @@ func (s *OrderService) SaveOrderAndOrderDetail(ctx context.Context, order *model
 
 		orderID = order.ID
 
-		// Save Idempotency Token into the database
-		if idempotencyToken != "" {
-			err = s.OrderRepository.SaveIdempotencyTx(ctx, tx, idempotencyToken)
+		// Insert the line items so they can be cancelled and tracked one by one
+		err = s.OrderRepository.InsertOrderItemsTx(ctx, tx, orderItemsFromCheckout(orderID, items))
+		if err != nil {
+			return err
+		}
+
+		err = s.appendOrderHistoryTx(ctx, tx, orderID, constant.OrderStatusTranslated[order.Status], "")
+		if err != nil {
+			return err
+		}
+
+		// Count the coupons against their usage limits
+		err = s.recordCouponUsageTx(ctx, tx, order, orderDetail.Discounts)
+		if err != nil {
+			return err
+		}
+
+		// Link the stock reservation so it is confirmed instead of expiring
+		if reservationID != "" {
+			err = s.OrderRepository.AttachStockReservationTx(ctx, tx, reservationID, orderID)
 			if err != nil {
 				return err
 			}
 		}
 
-		// Publish Kafka event to notify the order creation
-		err = producer.PublishOrderCreated(ctx, models.OrderCreatedEvent{
-			OrderID:         orderID,
-			UserID:          order.UserID,
-			TotalAmount:     order.Amount,
-			PaymentMethod:   order.PaymentMethod,
-			ShippingAddress: order.ShippingAddress,
-		})
+		// Save Idempotency Token into the database, the unique token guards against concurrent duplicates
+		if requestLog != nil {
+			requestLog.OrderID = &orderID
+			err = s.OrderRepository.SaveIdempotencyTx(ctx, tx, requestLog)
+			if err != nil {
+				if errors.Is(err, gorm.ErrDuplicatedKey) {
+					return constant.ErrDuplicateIdempotency
+				}
+				return err
+			}
+		}
+
+		// Queue Kafka event to notify the order creation
+		err = s.insertOutboxTx(ctx, tx, orderID, constant.TopicOrderCreated, orderCreatedEvent(orderID, order, orderDetail))
 		if err != nil {
 			return err
 		}
@@ -93,6 +137,265 @@ func (s *OrderService) SaveOrderAndOrderDetail(ctx context.Context, order *model
 	return orderID, nil
 }
 
+// insertOrderCancelledTx queue the order.cancelled event of an order with the quantities of its
+// line items that were still open
+func (s *OrderService) insertOrderCancelledTx(ctx context.Context, tx *gorm.DB, order *models.Order, reason string) error {
+	orderItems, err := s.OrderRepository.GetOrderItemsTx(ctx, tx, order.ID)
+	if err != nil {
+		return err
+	}
+	return s.insertOutboxTx(ctx, tx, order.ID, constant.TopicOrderCancelled, orderCancelledEvent(order, orderItems, reason))
+}
+
+// orderCreatedEvent build the order.created event of a saved order, amounts and rate are the ones snapshotted on the order
+func orderCreatedEvent(orderID int64, order *models.Order, orderDetail *models.OrderDetail) models.OrderCreatedEvent {
+	return models.OrderCreatedEvent{
+		OrderID:               orderID,
+		UserID:                order.UserID,
+		TotalAmount:           order.Amount,
+		Currency:              order.Currency,
+		BaseAmount:            order.BaseAmount,
+		BaseCurrency:          order.BaseCurrency,
+		ExchangeRate:          order.ExchangeRate,
+		Discounts:             orderDetail.Discounts,
+		PaymentMethod:         order.PaymentMethod,
+		ShippingAddress:       order.ShippingAddress,
+		ShippingAddressDetail: order.ShippingAddressDetail,
+		PriceBreakdown: models.PriceBreakdown{
+			Subtotal:    order.Subtotal,
+			Discount:    order.DiscountAmount,
+			ShippingFee: order.ShippingFee,
+			Tax:         order.TaxAmount,
+			GrandTotal:  order.Amount,
+		},
+	}
+}
+
+// orderCancelledEvent build the order.cancelled event with the quantities of the items that were still open
+func orderCancelledEvent(order *models.Order, orderItems []models.OrderItem, reason string) models.OrderCancelledEvent {
+	items := make([]models.OrderEventItem, 0, len(orderItems))
+	for _, item := range orderItems {
+		if item.OpenQty() == 0 {
+			continue
+		}
+		items = append(items, models.OrderEventItem{
+			ProductID: item.ProductID,
+			Quantity:  item.OpenQty(),
+			Price:     item.UnitPrice,
+		})
+	}
+
+	return models.OrderCancelledEvent{
+		OrderID:       order.ID,
+		UserID:        order.UserID,
+		Reason:        reason,
+		Items:         items,
+		TotalAmount:   order.Amount,
+		Currency:      order.Currency,
+		BaseAmount:    order.BaseAmount,
+		BaseCurrency:  order.BaseCurrency,
+		ExchangeRate:  order.ExchangeRate,
+		PaymentMethod: order.PaymentMethod,
+		CancelTime:    time.Now(),
+	}
+}
+
+// RequestPayment queue the payment request of a saved order with its snapshotted amount
+func (s *OrderService) RequestPayment(ctx context.Context, orderID int64, paymentRequestID string) error {
+	return s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		order, err := s.OrderRepository.GetOrderForUpdateTx(ctx, tx, orderID, 0)
+		if err != nil {
+			return err
+		}
+
+		return s.insertOutboxTx(ctx, tx, order.ID, constant.TopicPaymentRequest, models.PaymentRequestedEvent{
+			PaymentRequestID: paymentRequestID,
+			OrderID:          order.ID,
+			UserID:           order.UserID,
+			Amount:           order.Amount,
+			Currency:         order.Currency,
+			PaymentMethod:    order.PaymentMethod,
+			RequestTime:      time.Now(),
+		})
+	})
+}
+
+// CancelPayment queue the cancellation of the payment request of an order
+func (s *OrderService) CancelPayment(ctx context.Context, orderID int64, paymentRequestID string, reason string) error {
+	return s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		order, err := s.OrderRepository.GetOrderForUpdateTx(ctx, tx, orderID, 0)
+		if err != nil {
+			return err
+		}
+
+		return s.insertOutboxTx(ctx, tx, order.ID, constant.TopicPaymentCancel, models.PaymentCancelledEvent{
+			PaymentRequestID: paymentRequestID,
+			OrderID:          order.ID,
+			UserID:           order.UserID,
+			Reason:           reason,
+			CancelTime:       time.Now(),
+		})
+	})
+}
+
+// appendOrderHistoryTx add an entry to the status timeline of an order
+func (s *OrderService) appendOrderHistoryTx(ctx context.Context, tx *gorm.DB, orderID int64, status string, reason string) error {
+	return s.OrderRepository.InsertOrderStatusHistoryTx(ctx, tx, &models.OrderStatusHistory{
+		OrderID: orderID,
+		Status:  status,
+		Reason:  reason,
+	})
+}
+
+// insertOutboxTx serialize an order event and queue it on the outbox
+func (s *OrderService) insertOutboxTx(ctx context.Context, tx *gorm.DB, orderID int64, topic string, event interface{}) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return s.OrderRepository.InsertOutboxTx(ctx, tx, &models.OrderOutbox{
+		AggregateID:     orderID,
+		Topic:           topic,
+		MessageKey:      fmt.Sprintf("order-%d", orderID),
+		Payload:         string(payload),
+		Status:          constant.OutboxStatusPending,
+		NextAttemptTime: now,
+		CreateTime:      now,
+	})
+}
+
+// RelayOutbox publish the pending outbox events and mark them as sent. The events are claimed in a
+// short transaction and published after it commits, so a slow or failing publish holds no lock.
+// Events of the same message key stay in insertion order: a key whose oldest event is backing
+// off waits for it, other keys go on.
+func (s *OrderService) RelayOutbox(ctx context.Context, batchSize int, claimTTL time.Duration, publish func(ctx context.Context, outbox *models.OrderOutbox) error, backoff func(attempts int) time.Duration) (int, error) {
+	var outboxes []models.OrderOutbox
+	err := s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		var err error
+		outboxes, err = s.OrderRepository.ClaimOutboxTx(ctx, tx, batchSize, time.Now().Add(claimTTL))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var sent int
+	for i := range outboxes {
+		outbox := &outboxes[i]
+		if err = publish(ctx, outbox); err != nil {
+			attempts := outbox.Attempts + 1
+			log.Logger.WithFields(logrus.Fields{
+				"outbox_id":   outbox.ID,
+				"topic":       outbox.Topic,
+				"message_key": outbox.MessageKey,
+				"attempts":    attempts,
+				"err":         err.Error(),
+			}).Warn("failed to publish outbox event")
+
+			err = s.OrderRepository.MarkOutboxFailed(ctx, outbox.ID, attempts, err.Error(), time.Now().Add(backoff(attempts)))
+			if err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		// a failed mark leaves the event claimed, it is published again once the claim expires
+		if err = s.OrderRepository.MarkOutboxSent(ctx, outbox.ID); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// UpdateOrderStatus move an order to a new status and append it to the order history.
+// The order row is locked for the whole transaction, and check is called with the current
+// order so the caller can reject the transition before anything is written.
+// When param.EventKey was already processed the order is returned unchanged.
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, param *models.OrderStatusParam, check func(order *models.Order) error) (*models.Order, error) {
+	var updatedOrder *models.Order
+
+	err := s.OrderRepository.WithTransaction(ctx, func(tx *gorm.DB) error {
+		order, err := s.OrderRepository.GetOrderForUpdateTx(ctx, tx, param.OrderID, param.UserID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return constant.ErrOrderNotFound
+			}
+			return err
+		}
+
+		if param.EventKey != "" {
+			isNew, err := s.OrderRepository.SaveProcessedEventTx(ctx, tx, param.EventKey, order.ID)
+			if err != nil {
+				return err
+			}
+
+			if !isNew {
+				updatedOrder = order
+				return nil
+			}
+		}
+
+		if err = check(order); err != nil {
+			// the order is already where the caller wants it, e.g. a retried cancel
+			if errors.Is(err, constant.ErrStatusUnchanged) {
+				updatedOrder = order
+				return nil
+			}
+			return err
+		}
+
+		err = s.OrderRepository.UpdateOrderStatusTx(ctx, tx, order.ID, param.Status)
+		if err != nil {
+			return err
+		}
+
+		// an order that ends without being paid gives its coupon uses back
+		if param.Status == constant.OrderStatusCancelled || param.Status == constant.OrderStatusFailed {
+			err = s.OrderRepository.DeleteCouponUsageByOrderTx(ctx, tx, order.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Queue Kafka event so inventory and payment can compensate the cancelled order
+		if param.Status == constant.OrderStatusCancelled {
+			err = s.insertOrderCancelledTx(ctx, tx, order, param.Reason)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch param.Status {
+		case constant.OrderStatusCancelled, constant.OrderStatusFailed:
+			err = s.OrderRepository.CancelOrderItemsTx(ctx, tx, order.ID)
+		case constant.OrderStatusCompleted:
+			err = s.OrderRepository.FulfillOrderItemsTx(ctx, tx, order.ID)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = s.appendOrderHistoryTx(ctx, tx, order.ID, constant.OrderStatusTranslated[param.Status], param.Reason)
+		if err != nil {
+			return err
+		}
+
+		order.Status = param.Status
+		updatedOrder = order
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedOrder, nil
+}
+
+// GetOrderHistoryByUserId get at most param.Limit orders of the user
 func (s *OrderService) GetOrderHistoryByUserId(ctx context.Context, param *models.OrderHistoryParam) ([]models.OrderHistoryResponse, error) {
 	orderHistory, err := s.OrderRepository.GetOrderHistoryByUserId(ctx, param)
 	if err != nil {
@@ -101,11 +404,106 @@ func (s *OrderService) GetOrderHistoryByUserId(ctx context.Context, param *model
 	return orderHistory, nil
 }
 
-func (s *OrderService) GetProductInfo(ctx context.Context, productId int64) (models.Product, error) {
-	productDetail, err := s.OrderRepository.GetProductInfo(ctx, productId)
+func (s *OrderService) GetOrderDetailByID(ctx context.Context, orderID int64, userID int64) (*models.OrderDetailResponse, error) {
+	orderDetail, err := s.OrderRepository.GetOrderDetailByID(ctx, orderID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, constant.ErrOrderNotFound
+		}
+		return nil, err
+	}
+	return orderDetail, nil
+}
+
+func (s *OrderService) SaveStockReservation(ctx context.Context, reservation *models.StockReservation) error {
+	return s.OrderRepository.InsertStockReservation(ctx, reservation)
+}
+
+func (s *OrderService) UpdateStockReservationStatus(ctx context.Context, reservationID string, status int) error {
+	return s.OrderRepository.UpdateStockReservationStatus(ctx, reservationID, status)
+}
+
+// GetStockReservationByOrderID get the stock reservation of an order, nil when the order has none
+func (s *OrderService) GetStockReservationByOrderID(ctx context.Context, orderID int64) (*models.StockReservation, error) {
+	reservation, err := s.OrderRepository.GetStockReservationByOrderID(ctx, orderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// GetStockReservation get stock reservation by id, nil when it doesn't exist
+func (s *OrderService) GetStockReservation(ctx context.Context, reservationID string) (*models.StockReservation, error) {
+	reservation, err := s.OrderRepository.GetStockReservation(ctx, reservationID)
 	if err != nil {
-		return models.Product{}, err
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return reservation, nil
+}
+
+func (s *OrderService) GetPendingStockReservations(ctx context.Context, limit int) ([]models.StockReservationResult, error) {
+	return s.OrderRepository.GetPendingStockReservations(ctx, limit)
+}
+
+func (s *OrderService) UpdateStockItemReleaseStatus(ctx context.Context, releaseID string, status int) error {
+	return s.OrderRepository.UpdateStockItemReleaseStatus(ctx, releaseID, status)
+}
+
+func (s *OrderService) GetPendingStockItemReleases(ctx context.Context, limit int) ([]models.StockItemRelease, error) {
+	return s.OrderRepository.GetPendingStockItemReleases(ctx, limit)
+}
+
+func (s *OrderService) SaveCheckoutSaga(ctx context.Context, saga *models.CheckoutSaga) error {
+	return s.OrderRepository.InsertCheckoutSaga(ctx, saga)
+}
+
+func (s *OrderService) UpdateCheckoutSaga(ctx context.Context, saga *models.CheckoutSaga) error {
+	return s.OrderRepository.UpdateCheckoutSaga(ctx, saga)
+}
+
+func (s *OrderService) GetCheckoutSaga(ctx context.Context, sagaID string, userID int64) (*models.CheckoutSaga, error) {
+	saga, err := s.OrderRepository.GetCheckoutSaga(ctx, sagaID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, constant.ErrSagaNotFound
+		}
+		return nil, err
+	}
+	return saga, nil
+}
+
+// GetCheckoutSagaByOrderID get the saga that created an order, nil for orders created without one
+func (s *OrderService) GetCheckoutSagaByOrderID(ctx context.Context, orderID int64) (*models.CheckoutSaga, error) {
+	saga, err := s.OrderRepository.GetCheckoutSagaByOrderID(ctx, orderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return saga, nil
+}
+
+func (s *OrderService) GetStaleCheckoutSagas(ctx context.Context, statuses []int, before time.Time, limit int) ([]models.CheckoutSaga, error) {
+	return s.OrderRepository.GetStaleCheckoutSagas(ctx, statuses, before, limit)
+}
+
+func (s *OrderService) ClaimCheckoutSaga(ctx context.Context, saga *models.CheckoutSaga, claimTime time.Time) (bool, error) {
+	return s.OrderRepository.ClaimCheckoutSaga(ctx, saga, claimTime)
+}
+
+// GetProductsInfo get product info of the given ids keyed by product id
+func (s *OrderService) GetProductsInfo(ctx context.Context, productIds []int64) (map[int64]models.Product, error) {
+	products, err := s.OrderRepository.GetProductsInfo(ctx, productIds)
+	if err != nil {
+		return nil, err
 	}
 
-	return productDetail, nil
+	return products, nil
 }
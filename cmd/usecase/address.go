@@ -0,0 +1,268 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"order_service/infra/constant"
+	"order_service/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// addressRule is what a country requires from an address on top of the common fields
+type addressRule struct {
+	postalCode     *regexp.Regexp
+	phone          *regexp.Regexp
+	regionRequired bool
+}
+
+var defaultPhonePattern = regexp.MustCompile(`^\+?[0-9][0-9 -]{6,19}$`)
+
+var addressRules = map[string]addressRule{
+	"ID": {postalCode: regexp.MustCompile(`^\d{5}$`), phone: regexp.MustCompile(`^(\+62|62|0)8\d{7,12}$`), regionRequired: true},
+	"SG": {postalCode: regexp.MustCompile(`^\d{6}$`), phone: regexp.MustCompile(`^(\+65)?[689]\d{7}$`)},
+	"MY": {postalCode: regexp.MustCompile(`^\d{5}$`), phone: regexp.MustCompile(`^(\+?60|0)1\d{8,9}$`), regionRequired: true},
+	"TH": {postalCode: regexp.MustCompile(`^\d{5}$`), regionRequired: true},
+	"PH": {postalCode: regexp.MustCompile(`^\d{4}$`), regionRequired: true},
+	"VN": {postalCode: regexp.MustCompile(`^\d{6}$`)},
+	"US": {postalCode: regexp.MustCompile(`^\d{5}(-\d{4})?$`), regionRequired: true},
+	"GB": {postalCode: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`)},
+}
+
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// subdivisionPattern is the part of an ISO 3166-2 code after the country, "JB" in "ID-JB"
+var subdivisionPattern = regexp.MustCompile(`^[A-Z0-9]{1,3}$`)
+
+// subdivisions list the ISO 3166-2 codes of the countries priced per region, a region of another
+// country only has to be well formed
+var subdivisions = map[string]map[string]bool{
+	"ID": codeSet("AC BA BB BE BT GO JA JB JI JK JT KB KI KR KS KT KU LA MA MU NB NT PA PB PD PE PS PT RI SA SB SG SN SR SS ST SU YO"),
+	"MY": codeSet("01 02 03 04 05 06 07 08 09 10 11 12 13 14 15 16"),
+	"US": codeSet("AL AK AZ AR CA CO CT DE FL GA HI ID IL IN IA KS KY LA ME MD MA MI MN MS MO MT NE NV NH NJ NM NY NC ND OH OK OR PA RI SC SD TN TX UT VT VA WA WV WI WY DC AS GU MP PR UM VI"),
+}
+
+func codeSet(codes string) map[string]bool {
+	set := make(map[string]bool)
+	for _, code := range strings.Fields(codes) {
+		set[code] = true
+	}
+	return set
+}
+
+// resolveShippingAddress set the shipping address of a checkout. A saved address given by
+// address_id, or the user's default address when the request has none, is copied onto the
+// request so the order keeps a snapshot that later edits of the address book don't change.
+func (uc *OrderUseCase) resolveShippingAddress(ctx context.Context, param *models.CheckoutRequest) error {
+	inline := param.ShippingAddress.Address != nil || strings.TrimSpace(param.ShippingAddress.Legacy) != ""
+	if param.AddressID != 0 && inline {
+		return fmt.Errorf("%w: send either address_id or shipping_address", constant.ErrInvalidAddress)
+	}
+
+	var saved *models.UserAddress
+	var err error
+	switch {
+	case param.AddressID != 0:
+		saved, err = uc.OrderService.GetUserAddress(ctx, param.UserID, param.AddressID)
+	case !inline:
+		saved, err = uc.OrderService.GetDefaultUserAddress(ctx, param.UserID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if saved != nil {
+		snapshot := saved.Address
+		param.ShippingAddress = models.ShippingAddress{Address: &snapshot}
+	}
+	if err = uc.validateShippingAddress(&param.ShippingAddress); err != nil {
+		return err
+	}
+
+	if param.ShippingAddress.Address == nil && strings.TrimSpace(param.ShippingRegion) != "" {
+		param.ShippingRegion = normalizeRegion(param.ShippingRegion)
+		country, region, _ := strings.Cut(param.ShippingRegion, "-")
+		if !countryCodePattern.MatchString(country) {
+			return fmt.Errorf("%w: shipping_region must be an ISO 3166 code, e.g. ID or ID-JB", constant.ErrInvalidAddress)
+		}
+		if region != "" {
+			return validateRegion(country, region)
+		}
+	}
+	return nil
+}
+
+// validateShippingAddress normalize and validate the shipping address of a checkout. The legacy
+// free-form string is accepted as is while the compatibility mode is on.
+func (uc *OrderUseCase) validateShippingAddress(address *models.ShippingAddress) error {
+	if address.Address == nil {
+		if !uc.AddressConfig.AllowLegacyString {
+			return fmt.Errorf("%w: a structured shipping address is required", constant.ErrInvalidAddress)
+		}
+
+		address.Legacy = strings.TrimSpace(address.Legacy)
+		if address.Legacy == "" {
+			return fmt.Errorf("%w: shipping address is required", constant.ErrInvalidAddress)
+		}
+		return nil
+	}
+	return validateAddress(address.Address)
+}
+
+// validateAddress check the common fields of an address and the rules of its country
+func validateAddress(address *models.Address) error {
+	normalizeAddress(address)
+
+	if !countryCodePattern.MatchString(address.Country) {
+		return fmt.Errorf("%w: country must be an ISO 3166-1 alpha-2 code", constant.ErrInvalidAddress)
+	}
+
+	required := map[string]string{
+		"recipient_name": address.RecipientName,
+		"phone":          address.Phone,
+		"line1":          address.Line1,
+		"city":           address.City,
+	}
+	for _, field := range []string{"recipient_name", "phone", "line1", "city"} {
+		if required[field] == "" {
+			return fmt.Errorf("%w: %s is required", constant.ErrInvalidAddress, field)
+		}
+	}
+
+	rule, ok := addressRules[address.Country]
+	if !ok {
+		rule = addressRule{phone: defaultPhonePattern}
+	}
+
+	if rule.regionRequired && address.Region == "" {
+		return fmt.Errorf("%w: region is required in %s", constant.ErrInvalidAddress, address.Country)
+	}
+
+	if address.Region != "" {
+		address.Region = strings.TrimPrefix(address.Region, address.Country+"-")
+		if err := validateRegion(address.Country, address.Region); err != nil {
+			return err
+		}
+	}
+
+	if rule.postalCode != nil && !rule.postalCode.MatchString(address.PostalCode) {
+		return fmt.Errorf("%w: invalid postal code for %s", constant.ErrInvalidAddress, address.Country)
+	}
+
+	phonePattern := rule.phone
+	if phonePattern == nil {
+		phonePattern = defaultPhonePattern
+	}
+
+	if !phonePattern.MatchString(address.Phone) {
+		return fmt.Errorf("%w: invalid phone number for %s", constant.ErrInvalidAddress, address.Country)
+	}
+	return nil
+}
+
+// validateRegion check a region is the ISO 3166-2 subdivision code of a region of country, so it
+// can't miss the per region shipping and tax rates and silently be priced with the country ones
+func validateRegion(country string, region string) error {
+	if !subdivisionPattern.MatchString(region) {
+		return fmt.Errorf("%w: region must be an ISO 3166-2 subdivision code, e.g. JB for %s-JB", constant.ErrInvalidAddress, country)
+	}
+
+	if codes, ok := subdivisions[country]; ok && !codes[region] {
+		return fmt.Errorf("%w: unknown region %s-%s", constant.ErrInvalidAddress, country, region)
+	}
+	return nil
+}
+
+func normalizeAddress(address *models.Address) {
+	address.RecipientName = strings.TrimSpace(address.RecipientName)
+	address.Phone = strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(address.Phone))
+	address.Line1 = strings.TrimSpace(address.Line1)
+	address.Line2 = strings.TrimSpace(address.Line2)
+	address.City = strings.TrimSpace(address.City)
+	address.Region = strings.ToUpper(strings.TrimSpace(address.Region))
+	address.PostalCode = strings.ToUpper(strings.TrimSpace(address.PostalCode))
+	address.Country = strings.ToUpper(strings.TrimSpace(address.Country))
+}
+
+// pricingRegion give the region the shipping and tax tables are looked up with,
+// e.g. "ID-JB" which falls back to "ID" when the province isn't listed.
+// A legacy string address is priced with the region sent next to it.
+func (uc *OrderUseCase) pricingRegion(param *models.CheckoutRequest) string {
+	address := param.ShippingAddress.Address
+	if address == nil {
+		if strings.TrimSpace(param.ShippingRegion) == "" {
+			return uc.Pricing.DefaultRegion
+		}
+		return normalizeRegion(param.ShippingRegion)
+	}
+
+	if address.Region == "" {
+		return address.Country
+	}
+	return normalizeRegion(address.Country + "-" + address.Region)
+}
+
+func (uc *OrderUseCase) GetUserAddresses(ctx context.Context, userID int64) ([]models.UserAddress, error) {
+	addresses, err := uc.OrderService.GetUserAddresses(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if addresses == nil {
+		addresses = []models.UserAddress{}
+	}
+	return addresses, nil
+}
+
+// SaveUserAddress validate an address and add it to the user's address book
+func (uc *OrderUseCase) SaveUserAddress(ctx context.Context, userID int64, req *models.UserAddressRequest) (*models.UserAddress, error) {
+	address, err := newUserAddress(userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	address.CreateTime = address.UpdateTime
+	if err = uc.OrderService.SaveUserAddress(ctx, address); err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+// UpdateUserAddress validate an address and replace a saved address with it
+func (uc *OrderUseCase) UpdateUserAddress(ctx context.Context, userID int64, addressID int64, req *models.UserAddressRequest) (*models.UserAddress, error) {
+	address, err := newUserAddress(userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	address.ID = addressID
+	if err = uc.OrderService.UpdateUserAddress(ctx, address); err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+func (uc *OrderUseCase) DeleteUserAddress(ctx context.Context, userID int64, addressID int64) error {
+	return uc.OrderService.DeleteUserAddress(ctx, userID, addressID)
+}
+
+func newUserAddress(userID int64, req *models.UserAddressRequest) (*models.UserAddress, error) {
+	label := strings.TrimSpace(req.Label)
+	if len(label) > constant.MaxAddressLabelLength {
+		return nil, fmt.Errorf("%w: label is longer than %d characters", constant.ErrInvalidAddress, constant.MaxAddressLabelLength)
+	}
+
+	address := req.Address
+	if err := validateAddress(&address); err != nil {
+		return nil, err
+	}
+
+	return &models.UserAddress{
+		UserID:     userID,
+		Label:      label,
+		Address:    address,
+		IsDefault:  req.IsDefault,
+		UpdateTime: time.Now(),
+	}, nil
+}
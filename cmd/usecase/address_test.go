@@ -0,0 +1,97 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"order_service/infra/constant"
+	"order_service/models"
+	"testing"
+)
+
+func TestValidateAddressRegion(t *testing.T) {
+	tests := []struct {
+		country    string
+		region     string
+		postalCode string
+		phone      string
+		wantRegion string
+		wantErr    bool
+	}{
+		{country: "ID", region: "JB", postalCode: "40111", phone: "081234567890", wantRegion: "JB"},
+		{country: "ID", region: "id-jk", postalCode: "10110", phone: "081234567890", wantRegion: "JK"},
+		{country: "ID", region: "Jawa Barat", postalCode: "40111", phone: "081234567890", wantErr: true},
+		{country: "ID", region: "XX", postalCode: "40111", phone: "081234567890", wantErr: true},
+		{country: "MY", region: "14", postalCode: "50000", phone: "0123456789", wantRegion: "14"},
+		{country: "TH", region: "10", postalCode: "10200", phone: "+6621234567", wantRegion: "10"},
+		{country: "TH", region: "Bangkok", postalCode: "10200", phone: "+6621234567", wantErr: true},
+		{country: "SG", postalCode: "018956", phone: "91234567"},
+	}
+
+	for _, tt := range tests {
+		address := &models.Address{
+			RecipientName: "Budi",
+			Phone:         tt.phone,
+			Line1:         "Jl. Sudirman 1",
+			City:          "Kota",
+			Region:        tt.region,
+			PostalCode:    tt.postalCode,
+			Country:       tt.country,
+		}
+
+		err := validateAddress(address)
+		if tt.wantErr {
+			if !errors.Is(err, constant.ErrInvalidAddress) {
+				t.Errorf("%s %q: error = %v, want ErrInvalidAddress", tt.country, tt.region, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s %q: unexpected error %v", tt.country, tt.region, err)
+			continue
+		}
+		if address.Region != tt.wantRegion {
+			t.Errorf("%s %q: region = %q, want %q", tt.country, tt.region, address.Region, tt.wantRegion)
+		}
+	}
+}
+
+func TestResolveShippingRegion(t *testing.T) {
+	uc := &OrderUseCase{}
+	uc.AddressConfig.AllowLegacyString = true
+
+	tests := []struct {
+		region  string
+		want    string
+		wantErr bool
+	}{
+		{region: "", want: ""},
+		{region: "sg", want: "SG"},
+		{region: "id-jb", want: "ID-JB"},
+		{region: "ID-JAWA BARAT", wantErr: true},
+		{region: "Indonesia", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		param := &models.CheckoutRequest{
+			ShippingAddress: models.ShippingAddress{Legacy: "Jl. Sudirman 1, Jakarta"},
+			ShippingRegion:  tt.region,
+		}
+
+		err := uc.resolveShippingAddress(context.Background(), param)
+		if tt.wantErr {
+			if !errors.Is(err, constant.ErrInvalidAddress) {
+				t.Errorf("%q: error = %v, want ErrInvalidAddress", tt.region, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.region, err)
+			continue
+		}
+		if param.ShippingRegion != tt.want {
+			t.Errorf("%q: shipping region = %q, want %q", tt.region, param.ShippingRegion, tt.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"order_service/models"
+	"order_service/money"
+)
+
+// RateProvider give the exchange rate from the catalog currency to the currency an order is paid in
+type RateProvider interface {
+	Rate(ctx context.Context, base money.Currency, quote money.Currency) (money.Rate, error)
+}
+
+// priceInCurrency resolve the order currency and convert the catalog prices of the items into it.
+// Unit prices are converted rather than the total so every line adds up to the charged amount.
+func (uc *OrderUseCase) priceInCurrency(ctx context.Context, param *models.CheckoutRequest) (money.Rate, error) {
+	currency := uc.BaseCurrency
+	if param.Currency != "" {
+		parsed, err := money.ParseCurrency(string(param.Currency))
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", err, param.Currency)
+		}
+		currency = parsed
+	}
+	param.Currency = currency
+
+	rate, err := uc.RateProvider.Rate(ctx, uc.BaseCurrency, currency)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range param.Items {
+		item := &param.Items[i]
+		item.BasePrice = item.Price
+		item.Price, err = money.Convert(item.BasePrice, rate)
+		if err != nil {
+			return 0, fmt.Errorf("order amount is too large: %w", err)
+		}
+	}
+	return rate, nil
+}
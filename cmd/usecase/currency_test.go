@@ -0,0 +1,113 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"order_service/cmd/repository"
+	"order_service/config"
+	"order_service/infra/constant"
+	"order_service/models"
+	"order_service/money"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newCurrencyTestUseCase(t *testing.T, ratesFile string) *OrderUseCase {
+	t.Helper()
+	provider, err := repository.NewFileRateProvider(config.CurrencyConfig{Base: "IDR", RatesFile: ratesFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &OrderUseCase{RateProvider: provider, BaseCurrency: "IDR"}
+}
+
+func TestPriceInCurrency(t *testing.T) {
+	uc := newCurrencyTestUseCase(t, "testdata/rates.json")
+
+	tests := []struct {
+		currency     money.Currency
+		wantCurrency money.Currency
+		wantRate     string
+		wantPrice    string
+		wantErr      error
+	}{
+		{currency: "", wantCurrency: "IDR", wantRate: "1.00000000", wantPrice: "150000.00"},
+		{currency: "usd", wantCurrency: "USD", wantRate: "0.00006150", wantPrice: "9.22"},
+		{currency: "SGD", wantCurrency: "SGD", wantRate: "0.00008250", wantPrice: "12.38"},
+		{currency: "EUR", wantErr: constant.ErrUnsupportedCurrency},
+		{currency: "JPY", wantErr: money.ErrInvalidCurrency},
+		{currency: "dollar", wantErr: money.ErrInvalidCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.currency), func(t *testing.T) {
+			param := &models.CheckoutRequest{
+				Currency: tt.currency,
+				Items:    []models.CheckoutItem{{ProductID: 1, Quantity: 2, Price: money.FromMinorUnits(15000000)}},
+			}
+
+			rate, err := uc.priceInCurrency(context.Background(), param)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("priceInCurrency error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			item := param.Items[0]
+			if param.Currency != tt.wantCurrency || rate.String() != tt.wantRate {
+				t.Fatalf("currency = %s rate = %s, want %s %s", param.Currency, rate, tt.wantCurrency, tt.wantRate)
+			}
+			if item.Price.String() != tt.wantPrice || item.BasePrice.String() != "150000.00" {
+				t.Fatalf("price = %s base = %s, want %s 150000.00", item.Price, item.BasePrice, tt.wantPrice)
+			}
+		})
+	}
+}
+
+// TestBuildOrderSnapshotsRate check the order keeps the rate quoted at checkout even when the
+// rates change before the saga saves it
+func TestBuildOrderSnapshotsRate(t *testing.T) {
+	uc := newCurrencyTestUseCase(t, "testdata/rates.json")
+
+	param := models.CheckoutRequest{
+		Currency: "USD",
+		Items:    []models.CheckoutItem{{ProductID: 1, Quantity: 2, Price: money.FromMinorUnits(15000000)}},
+	}
+	quotedRate, err := uc.priceInCurrency(context.Background(), &param)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pricing := models.PriceBreakdown{Subtotal: money.FromMinorUnits(1844), GrandTotal: money.FromMinorUnits(1844)}
+	basePricing := models.PriceBreakdown{Subtotal: money.FromMinorUnits(30000000), GrandTotal: money.FromMinorUnits(30000000)}
+	data := &models.CheckoutSagaData{
+		Request:      param,
+		ExchangeRate: quotedRate,
+		Pricing:      &pricing,
+		BasePricing:  &basePricing,
+	}
+
+	// the rates move between the quote and the saga step saving the order
+	movedRates := filepath.Join(t.TempDir(), "rates.json")
+	if err = os.WriteFile(movedRates, []byte(`{"base": "IDR", "rates": {"USD": "0.00007000"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	uc.RateProvider = newCurrencyTestUseCase(t, movedRates).RateProvider
+
+	order, _, err := uc.buildOrder(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if order.ExchangeRate != quotedRate || order.Currency != "USD" || order.BaseCurrency != "IDR" {
+		t.Fatalf("order rate = %s %s / %s, want %s USD / IDR", order.ExchangeRate, order.Currency, order.BaseCurrency, quotedRate)
+	}
+	if order.Amount.String() != "18.44" || order.BaseAmount.String() != "300000.00" {
+		t.Fatalf("order amounts = %s / %s, want 18.44 / 300000.00", order.Amount, order.BaseAmount)
+	}
+}
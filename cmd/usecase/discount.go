@@ -0,0 +1,161 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"order_service/infra/constant"
+	"order_service/models"
+	"order_service/money"
+	"sort"
+	"strings"
+	"time"
+)
+
+// couponStage order the coupons of a checkout: item discounts come first, then the percentage
+// is taken off what's left, then fixed amounts. Free shipping doesn't touch the subtotal.
+var couponStage = map[int]int{
+	constant.CouponTypeBuyXGetY:     0,
+	constant.CouponTypePercentage:   1,
+	constant.CouponTypeFixedAmount:  2,
+	constant.CouponTypeFreeShipping: 3,
+}
+
+// applyCoupons validate the coupon codes of a checkout and compute the discount of each one.
+// Discounts are computed on the catalog prices, never go past the subtotal, and are converted
+// to the order currency with the checkout exchange rate.
+func (uc *OrderUseCase) applyCoupons(ctx context.Context, param *models.CheckoutRequest, baseSubtotal money.Amount, rate money.Rate) ([]models.AppliedDiscount, error) {
+	if len(param.CouponCodes) == 0 {
+		return nil, nil
+	}
+
+	if len(param.CouponCodes) > constant.MaxCouponsPerOrder {
+		return nil, fmt.Errorf("%w: at most %d coupons per order", constant.ErrCouponNotApplicable, constant.MaxCouponsPerOrder)
+	}
+
+	codes := make([]string, 0, len(param.CouponCodes))
+	seen := map[string]bool{}
+	for _, code := range param.CouponCodes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" || seen[code] {
+			return nil, fmt.Errorf("%w: empty or duplicate coupon code", constant.ErrCouponNotApplicable)
+		}
+		seen[code] = true
+		codes = append(codes, code)
+	}
+	param.CouponCodes = codes
+
+	couponsByCode, err := uc.OrderService.GetCouponsByCodes(ctx, codes)
+	if err != nil {
+		return nil, err
+	}
+
+	coupons := make([]models.Coupon, 0, len(codes))
+	for _, code := range codes {
+		coupon, ok := couponsByCode[code]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", constant.ErrCouponNotFound, code)
+		}
+		coupons = append(coupons, coupon)
+	}
+
+	sort.SliceStable(coupons, func(i, j int) bool {
+		return couponStage[coupons[i].Type] < couponStage[coupons[j].Type]
+	})
+
+	now := time.Now()
+	remaining := baseSubtotal
+	discounts := make([]models.AppliedDiscount, 0, len(coupons))
+	for _, coupon := range coupons {
+		if err = uc.checkCouponEligibility(ctx, &coupon, param.UserID, baseSubtotal, now); err != nil {
+			return nil, err
+		}
+
+		discount, err := couponDiscount(&coupon, param.Items, remaining)
+		if err != nil {
+			return nil, err
+		}
+		discount = min(discount, remaining)
+		remaining -= discount
+
+		amount, err := money.Convert(discount, rate)
+		if err != nil {
+			return nil, err
+		}
+
+		discounts = append(discounts, models.AppliedDiscount{
+			CouponID:     coupon.ID,
+			Code:         coupon.Code,
+			Type:         constant.CouponTypeTranslated[coupon.Type],
+			Amount:       amount,
+			BaseAmount:   discount,
+			FreeShipping: coupon.Type == constant.CouponTypeFreeShipping,
+		})
+	}
+	return discounts, nil
+}
+
+// checkCouponEligibility check the validity window, minimum spend and per-user limit of a coupon.
+// The limit is checked again when the order is saved, this only fails early.
+func (uc *OrderUseCase) checkCouponEligibility(ctx context.Context, coupon *models.Coupon, userID int64, baseSubtotal money.Amount, now time.Time) error {
+	if !coupon.Active || (coupon.StartTime != nil && now.Before(*coupon.StartTime)) || (coupon.EndTime != nil && now.After(*coupon.EndTime)) {
+		return fmt.Errorf("%w: %s is not active", constant.ErrCouponNotApplicable, coupon.Code)
+	}
+
+	if baseSubtotal < coupon.MinSpend {
+		return fmt.Errorf("%w: %s requires a minimum spend of %s", constant.ErrCouponNotApplicable, coupon.Code, coupon.MinSpend)
+	}
+
+	if coupon.MaxUsesPerUser > 0 {
+		used, err := uc.OrderService.CountCouponUsage(ctx, coupon.ID, userID)
+		if err != nil {
+			return err
+		}
+
+		if used >= int64(coupon.MaxUsesPerUser) {
+			return fmt.Errorf("%w: %s", constant.ErrCouponUsageExceeded, coupon.Code)
+		}
+	}
+	return nil
+}
+
+// couponDiscount compute the discount of a coupon in the catalog currency
+func couponDiscount(coupon *models.Coupon, items []models.CheckoutItem, remaining money.Amount) (money.Amount, error) {
+	switch coupon.Type {
+	case constant.CouponTypePercentage:
+		// value is a percentage with two decimals, e.g. 12.50 is 1250 hundredths of a percent
+		discount, err := remaining.MulRatio(coupon.Value.MinorUnits(), 100*100)
+		if err != nil {
+			return 0, err
+		}
+
+		if coupon.MaxDiscount > 0 {
+			discount = min(discount, coupon.MaxDiscount)
+		}
+		return discount, nil
+	case constant.CouponTypeFixedAmount:
+		return coupon.Value, nil
+	case constant.CouponTypeBuyXGetY:
+		if coupon.BuyQty <= 0 || coupon.GetQty <= 0 {
+			return 0, fmt.Errorf("%w: %s", constant.ErrCouponNotApplicable, coupon.Code)
+		}
+
+		for _, item := range items {
+			if item.ProductID != coupon.ProductID {
+				continue
+			}
+
+			// every buy + get units of the product, get units are free
+			freeQty := item.Quantity / (coupon.BuyQty + coupon.GetQty) * coupon.GetQty
+			if freeQty == 0 {
+				break
+			}
+			return item.BasePrice.Mul(freeQty)
+		}
+		return 0, fmt.Errorf("%w: %s requires buying %d of product %d", constant.ErrCouponNotApplicable,
+			coupon.Code, coupon.BuyQty+coupon.GetQty, coupon.ProductID)
+	case constant.CouponTypeFreeShipping:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("%w: %s has an unknown type", constant.ErrCouponNotApplicable, coupon.Code)
+	}
+}
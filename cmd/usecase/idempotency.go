@@ -0,0 +1,190 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"order_service/infra/constant"
+	"order_service/infra/log"
+	"order_service/infra/utils"
+	"order_service/models"
+	"time"
+)
+
+// checkoutFingerprint is the part of a checkout request that decides the order. Prices sent by
+// the client are left out, the order is priced from the catalog.
+type checkoutFingerprint struct {
+	Items           []checkoutItemFingerprint `json:"items"`
+	PaymentMethod   string                    `json:"payment_method"`
+	ShippingAddress models.ShippingAddress    `json:"shipping_address"`
+	ShippingRegion  string                    `json:"shipping_region"`
+	AddressID       int64                     `json:"address_id"`
+	Currency        string                    `json:"currency"`
+	CouponCodes     []string                  `json:"coupon_codes"`
+}
+
+type checkoutItemFingerprint struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int64 `json:"quantity"`
+}
+
+// checkoutRequestHash fingerprint a checkout request so a retry can be told apart from a reused token
+func checkoutRequestHash(param *models.CheckoutRequest) (string, error) {
+	fingerprint := checkoutFingerprint{
+		Items:           make([]checkoutItemFingerprint, 0, len(param.Items)),
+		PaymentMethod:   param.PaymentMethod,
+		ShippingAddress: param.ShippingAddress,
+		ShippingRegion:  param.ShippingRegion,
+		AddressID:       param.AddressID,
+		Currency:        string(param.Currency),
+		CouponCodes:     param.CouponCodes,
+	}
+	for _, item := range param.Items {
+		fingerprint.Items = append(fingerprint.Items, checkoutItemFingerprint{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+
+	payload, err := json.Marshal(fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checkoutLockKey scope the redis lock of an idempotency token to its user
+func checkoutLockKey(param *models.CheckoutRequest) string {
+	return fmt.Sprintf("%d:%s", param.UserID, param.IdempotencyToken)
+}
+
+// newRequestLog build the request log saved with the order so a retry can replay the response
+func newRequestLog(data *models.CheckoutSagaData) *models.OrderRequestLog {
+	if data.Request.IdempotencyToken == "" {
+		return nil
+	}
+
+	return &models.OrderRequestLog{
+		UserID:           data.Request.UserID,
+		IdempotencyToken: data.Request.IdempotencyToken,
+		ResponseStatus:   http.StatusCreated,
+		RequestHash:      data.RequestHash,
+		CreateTime:       time.Now(),
+	}
+}
+
+// replayCheckout rebuild the response of an already processed checkout
+func (uc *OrderUseCase) replayCheckout(ctx context.Context, reqLog *models.OrderRequestLog, requestHash string) (*models.CheckoutResponse, error) {
+	if reqLog.RequestHash != requestHash {
+		return nil, constant.ErrIdempotencyKeyReused
+	}
+
+	response := &models.CheckoutResponse{
+		ResponseStatus: reqLog.ResponseStatus,
+		Replayed:       true,
+	}
+
+	if reqLog.OrderID != nil {
+		response.OrderID = *reqLog.OrderID
+
+		saga, err := uc.OrderService.GetCheckoutSagaByOrderID(ctx, response.OrderID)
+		if err != nil {
+			return nil, err
+		}
+
+		if saga != nil {
+			response.SagaID = saga.ID
+		}
+	}
+	return response, nil
+}
+
+// checkOutIdempotent run a checkout that carries an idempotency token, tokens are scoped to the
+// user sending them. A token seen before replays the original response, and a redis lock keeps
+// concurrent duplicates from checking out twice. The unique (user_id, token) in order_request_log
+// still catches duplicates if redis is unavailable.
+func (uc *OrderUseCase) checkOutIdempotent(ctx context.Context, param *models.CheckoutRequest) (*models.CheckoutResponse, error) {
+	requestHash, err := checkoutRequestHash(param)
+	if err != nil {
+		return nil, err
+	}
+
+	reqLog, err := uc.OrderService.GetIdempotency(ctx, param.UserID, param.IdempotencyToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if reqLog != nil {
+		return uc.replayCheckout(ctx, reqLog, requestHash)
+	}
+
+	lockOwner := uuid.New().String()
+	locked, err := uc.OrderService.AcquireIdempotencyLock(ctx, checkoutLockKey(param), lockOwner, uc.IdempotencyConfig.LockTTL)
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"idempotency_token": param.IdempotencyToken,
+			"err":               err.Error(),
+		}).Warn("failed to lock idempotency token, relying on the unique constraint")
+	}
+
+	if err == nil && !locked {
+		return nil, constant.ErrRequestInProgress
+	}
+
+	if locked {
+		// the saga can outlast the lock ttl, keep the lock while the checkout runs
+		lockTTL := uc.IdempotencyConfig.LockTTL
+		stop := utils.Heartbeat(ctx, lockTTL/3, func(ctx context.Context) {
+			if err := uc.OrderService.RefreshIdempotencyLock(ctx, checkoutLockKey(param), lockOwner, lockTTL); err != nil {
+				log.Logger.WithFields(logrus.Fields{
+					"idempotency_token": param.IdempotencyToken,
+					"err":               err.Error(),
+				}).Warn("failed to refresh idempotency lock")
+			}
+		})
+
+		defer func() {
+			stop()
+			if err := uc.OrderService.ReleaseIdempotencyLock(context.WithoutCancel(ctx), checkoutLockKey(param), lockOwner); err != nil {
+				log.Logger.WithFields(logrus.Fields{
+					"idempotency_token": param.IdempotencyToken,
+					"err":               err.Error(),
+				}).Warn("failed to release idempotency lock")
+			}
+		}()
+
+		// the request holding the lock before us may have finished in between
+		reqLog, err = uc.OrderService.GetIdempotency(ctx, param.UserID, param.IdempotencyToken)
+		if err != nil {
+			return nil, err
+		}
+
+		if reqLog != nil {
+			return uc.replayCheckout(ctx, reqLog, requestHash)
+		}
+	}
+
+	quote, err := uc.validateCheckout(ctx, param)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := uc.startCheckoutSaga(ctx, param, quote, requestHash)
+	if errors.Is(err, constant.ErrDuplicateIdempotency) {
+		reqLog, err = uc.OrderService.GetIdempotency(ctx, param.UserID, param.IdempotencyToken)
+		if err != nil {
+			return nil, err
+		}
+
+		if reqLog != nil {
+			return uc.replayCheckout(ctx, reqLog, requestHash)
+		}
+		return nil, constant.ErrRequestInProgress
+	}
+	return response, err
+}
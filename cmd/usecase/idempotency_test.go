@@ -0,0 +1,43 @@
+package usecase
+
+import (
+	"order_service/models"
+	"order_service/money"
+	"testing"
+)
+
+func TestCheckoutRequestHash(t *testing.T) {
+	request := func(quantity int64, price money.Amount) *models.CheckoutRequest {
+		return &models.CheckoutRequest{
+			UserID:           3,
+			Items:            []models.CheckoutItem{{ProductID: 1, Quantity: quantity, Price: price}},
+			PaymentMethod:    "bank_transfer",
+			IdempotencyToken: "token-1",
+		}
+	}
+
+	hash := func(param *models.CheckoutRequest) string {
+		t.Helper()
+		sum, err := checkoutRequestHash(param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+
+	original := hash(request(2, 0))
+
+	// the price a client sends is ignored, the order is priced from the catalog
+	if got := hash(request(2, money.FromMinorUnits(100))); got != original {
+		t.Fatalf("hash changed with the client price: %s, want %s", got, original)
+	}
+	if got := hash(request(3, 0)); got == original {
+		t.Fatal("hash didn't change with the quantity")
+	}
+
+	withCoupon := request(2, 0)
+	withCoupon.CouponCodes = []string{"SAVE10"}
+	if got := hash(withCoupon); got == original {
+		t.Fatal("hash didn't change with the coupons")
+	}
+}
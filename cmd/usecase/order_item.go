@@ -0,0 +1,206 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"order_service/infra/constant"
+	"order_service/models"
+	"order_service/money"
+)
+
+// CancelOrderItems cancel some quantity of specific items of an order. The same rules as cancelling
+// the whole order apply, and at least one unit has to stay on the order: cancelling everything goes
+// through CancelOrder. The order is priced again from its own breakdown without the cancelled units.
+func (uc *OrderUseCase) CancelOrderItems(ctx context.Context, param *models.OrderItemCancelParam) (*models.Order, error) {
+	if len(param.Items) == 0 {
+		return nil, fmt.Errorf("%w: no item to cancel", constant.ErrInvalidItemCancel)
+	}
+
+	order, release, err := uc.OrderService.CancelOrderItems(ctx, param, func(order *models.Order, items []models.OrderItem, discounts []models.AppliedDiscount) (*models.CheckoutQuote, error) {
+		err := uc.checkCancellable(order, &models.OrderStatusParam{
+			OrderID: param.OrderID,
+			UserID:  param.UserID,
+			Status:  constant.OrderStatusCancelled,
+			Reason:  param.Reason,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		subtotal, baseSubtotal, err := keptSubtotals(items)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = cancelItemQuantities(items, param.Items); err != nil {
+			return nil, err
+		}
+
+		newSubtotal, newBaseSubtotal, err := keptSubtotals(items)
+		if err != nil {
+			return nil, err
+		}
+
+		return repriceKeptItems(order, discounts, subtotal, baseSubtotal, newSubtotal, newBaseSubtotal)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uc.releaseOrderItemsStock(ctx, release)
+	return order, nil
+}
+
+// cancelItemQuantities add the requested quantities to the cancelled quantities of the items
+func cancelItemQuantities(items []models.OrderItem, cancels []models.OrderItemCancel) error {
+	index := make(map[int64]int, len(items))
+	for i, item := range items {
+		index[item.ID] = i
+	}
+
+	for _, cancel := range cancels {
+		i, ok := index[cancel.ItemID]
+		if !ok {
+			return fmt.Errorf("%w: item %d is not part of the order", constant.ErrInvalidItemCancel, cancel.ItemID)
+		}
+
+		item := &items[i]
+		if cancel.Quantity <= 0 || cancel.Quantity > item.OpenQty() {
+			return fmt.Errorf("%w: item %d has %d unit(s) left to cancel", constant.ErrInvalidItemCancel, item.ID, item.OpenQty())
+		}
+
+		item.CancelledQty += cancel.Quantity
+		item.Status = orderItemStatus(item)
+	}
+
+	for _, item := range items {
+		if item.OpenQty() > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: every item would be cancelled, cancel the order instead", constant.ErrInvalidItemCancel)
+}
+
+func orderItemStatus(item *models.OrderItem) int {
+	switch {
+	case item.CancelledQty == item.Quantity:
+		return constant.OrderItemStatusCancelled
+	case item.CancelledQty > 0:
+		return constant.OrderItemStatusPartiallyCancelled
+	default:
+		return constant.OrderItemStatusActive
+	}
+}
+
+// keptSubtotals sum the price of the units that are not cancelled, in the order and in the catalog currency
+func keptSubtotals(items []models.OrderItem) (money.Amount, money.Amount, error) {
+	var subtotal, baseSubtotal money.Amount
+	for _, item := range items {
+		qty := item.Quantity - item.CancelledQty
+
+		lineAmount, err := item.UnitPrice.Mul(qty)
+		if err == nil {
+			subtotal, err = subtotal.Add(lineAmount)
+		}
+		if err == nil {
+			lineAmount, err = item.BaseUnitPrice.Mul(qty)
+		}
+		if err == nil {
+			baseSubtotal, err = baseSubtotal.Add(lineAmount)
+		}
+
+		if err != nil {
+			return 0, 0, fmt.Errorf("order amount is too large: %w", err)
+		}
+	}
+	return subtotal, baseSubtotal, nil
+}
+
+// repriceKeptItems price what is left of an order from the breakdown stored at checkout rather than
+// the current pricing tables, so a cancellation never charges more than the order did. Coupons and
+// tax shrink with the subtotal, like a refund, and the shipping fee is kept since the order still ships.
+// The order only keeps the grand total in the catalog currency, it is scaled with the order total.
+func repriceKeptItems(order *models.Order, discounts []models.AppliedDiscount, subtotal, baseSubtotal, newSubtotal, newBaseSubtotal money.Amount) (*models.CheckoutQuote, error) {
+	var err error
+	scaled := make([]models.AppliedDiscount, 0, len(discounts))
+	var discount, baseDiscount money.Amount
+	for _, applied := range discounts {
+		if applied.Amount, err = scaleAmount(applied.Amount, newSubtotal, subtotal); err != nil {
+			return nil, err
+		}
+		if applied.BaseAmount, err = scaleAmount(applied.BaseAmount, newBaseSubtotal, baseSubtotal); err != nil {
+			return nil, err
+		}
+		discount += applied.Amount
+		baseDiscount += applied.BaseAmount
+		scaled = append(scaled, applied)
+	}
+
+	pricing := models.PriceBreakdown{
+		Subtotal:    newSubtotal,
+		Discount:    min(discount, newSubtotal),
+		ShippingFee: order.ShippingFee,
+	}
+
+	// orders priced before the pricing pipeline have no breakdown, only their items are charged
+	if order.Subtotal > 0 {
+		taxable := order.Subtotal - order.DiscountAmount + order.ShippingFee
+		newTaxable := pricing.Subtotal - pricing.Discount + pricing.ShippingFee
+		if pricing.Tax, err = scaleAmount(order.TaxAmount, newTaxable, taxable); err != nil {
+			return nil, err
+		}
+	}
+
+	total, err := (pricing.Subtotal - pricing.Discount).Add(pricing.ShippingFee)
+	if err == nil {
+		total, err = total.Add(pricing.Tax)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("order amount is too large: %w", err)
+	}
+	pricing.GrandTotal = min(total, order.Amount)
+
+	basePricing := models.PriceBreakdown{
+		Subtotal:   newBaseSubtotal,
+		Discount:   min(baseDiscount, newBaseSubtotal),
+		GrandTotal: pricing.GrandTotal,
+	}
+	if order.Amount > 0 && order.BaseAmount > 0 {
+		if basePricing.GrandTotal, err = scaleAmount(order.BaseAmount, pricing.GrandTotal, order.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.CheckoutQuote{
+		ExchangeRate: order.ExchangeRate,
+		Discounts:    scaled,
+		Region:       order.PricingRegion,
+		Pricing:      pricing,
+		BasePricing:  basePricing,
+	}, nil
+}
+
+// scaleAmount return amount * to / from, an amount scaled from a zero total stays as it is
+func scaleAmount(amount money.Amount, to money.Amount, from money.Amount) (money.Amount, error) {
+	if from == 0 {
+		return amount, nil
+	}
+	return amount.MulRatio(to.MinorUnits(), from.MinorUnits())
+}
+
+func toOrderItemResponses(items []models.OrderItem) []models.OrderItemResponse {
+	responses := make([]models.OrderItemResponse, 0, len(items))
+	for _, item := range items {
+		responses = append(responses, models.OrderItemResponse{
+			ItemID:       item.ID,
+			ProductID:    item.ProductID,
+			Quantity:     item.Quantity,
+			UnitPrice:    item.UnitPrice,
+			Status:       constant.OrderItemStatusTranslated[item.Status],
+			FulfilledQty: item.FulfilledQty,
+			CancelledQty: item.CancelledQty,
+			RefundedQty:  item.RefundedQty,
+		})
+	}
+	return responses
+}
@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"order_service/infra/constant"
+	"order_service/infra/log"
+	"order_service/models"
+	"order_service/money"
+)
+
+// returnStatusTransitions lists, for every return status, the statuses an admin can move it to
+var returnStatusTransitions = map[int][]int{
+	constant.ReturnStatusRequested: {
+		constant.ReturnStatusApproved,
+		constant.ReturnStatusRejected,
+	},
+	constant.ReturnStatusApproved: {
+		constant.ReturnStatusReceived,
+	},
+}
+
+// RequestOrderReturn open a return for fulfilled items of a completed order. An item can't be
+// returned more than it was fulfilled, counting its refunded units and the units of open returns.
+func (uc *OrderUseCase) RequestOrderReturn(ctx context.Context, param *models.OrderReturnParam) (*models.OrderReturnResponse, error) {
+	if len(param.Items) == 0 {
+		return nil, fmt.Errorf("%w: no item to return", constant.ErrInvalidReturn)
+	}
+
+	orderReturn, err := uc.OrderService.CreateOrderReturn(ctx, param, func(order *models.Order, items []models.OrderItem, pendingQty map[int64]int64) error {
+		if order.Status != constant.OrderStatusCompleted {
+			return fmt.Errorf("%w: order is %s, only completed orders can be returned", constant.ErrInvalidReturn, constant.OrderStatusTranslated[order.Status])
+		}
+
+		requested := make(map[int64]int64, len(param.Items))
+		for _, item := range param.Items {
+			if item.Quantity <= 0 {
+				return fmt.Errorf("%w: quantity of item %d must be positive", constant.ErrInvalidReturn, item.ItemID)
+			}
+			requested[item.ItemID] += item.Quantity
+		}
+
+		for _, item := range items {
+			qty, ok := requested[item.ID]
+			if !ok {
+				continue
+			}
+			delete(requested, item.ID)
+
+			returnable := item.FulfilledQty - item.RefundedQty - pendingQty[item.ID]
+			if qty > returnable {
+				return fmt.Errorf("%w: item %d has %d unit(s) left to return", constant.ErrInvalidReturn, item.ID, max(returnable, 0))
+			}
+		}
+
+		for itemID := range requested {
+			return fmt.Errorf("%w: item %d is not part of the order", constant.ErrInvalidReturn, itemID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OrderReturnResponse{
+		ReturnID:   orderReturn.ID,
+		OrderID:    orderReturn.OrderID,
+		Status:     constant.ReturnStatusTranslated[orderReturn.Status],
+		Reason:     orderReturn.Reason,
+		Items:      param.Items,
+		CreateTime: orderReturn.CreateTime,
+		UpdateTime: orderReturn.UpdateTime,
+	}, nil
+}
+
+// ReviewOrderReturn approve or reject a requested return
+func (uc *OrderUseCase) ReviewOrderReturn(ctx context.Context, param *models.ReturnReviewParam) (*models.OrderReturn, error) {
+	return uc.OrderService.ReviewOrderReturn(ctx, param, func(orderReturn *models.OrderReturn) error {
+		return validateReturnTransition(orderReturn.Status, param.Status)
+	})
+}
+
+// ReceiveOrderReturn mark the items of an approved return as received and refund them
+func (uc *OrderUseCase) ReceiveOrderReturn(ctx context.Context, returnID int64) (*models.OrderRefund, error) {
+	return uc.OrderService.ReceiveOrderReturn(ctx, returnID, func(orderReturn *models.OrderReturn, order *models.Order, orderItems []models.OrderItem, returnItems []models.OrderReturnItem, refunded money.Amount) (*models.OrderRefund, error) {
+		if err := validateReturnTransition(orderReturn.Status, constant.ReturnStatusReceived); err != nil {
+			return nil, err
+		}
+		return uc.priceRefund(orderReturn, order, orderItems, returnItems, refunded)
+	})
+}
+
+// priceRefund price the refund of returned items. The items get their share of the order discount,
+// and the tax of the discounted items is refunded with them. Shipping is not refunded, and rounding
+// can never take the refunds of an order past what it was charged.
+func (uc *OrderUseCase) priceRefund(orderReturn *models.OrderReturn, order *models.Order, orderItems []models.OrderItem, returnItems []models.OrderReturnItem, refunded money.Amount) (*models.OrderRefund, error) {
+	unitPrice := make(map[int64]money.Amount, len(orderItems))
+	for _, item := range orderItems {
+		unitPrice[item.ID] = item.UnitPrice
+	}
+
+	var subtotal money.Amount
+	for _, returnItem := range returnItems {
+		lineAmount, err := unitPrice[returnItem.OrderItemID].Mul(returnItem.Quantity)
+		if err == nil {
+			subtotal, err = subtotal.Add(lineAmount)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("refund amount is too large: %w", err)
+		}
+	}
+
+	// orders priced before the pricing pipeline have no breakdown, their items are refunded at their price
+	var discount, tax money.Amount
+	var err error
+	if order.Subtotal > 0 {
+		if discount, err = scaleAmount(order.DiscountAmount, subtotal, order.Subtotal); err != nil {
+			return nil, err
+		}
+
+		taxable := order.Subtotal - order.DiscountAmount + order.ShippingFee
+		if tax, err = scaleAmount(order.TaxAmount, subtotal-discount, taxable); err != nil {
+			return nil, err
+		}
+	}
+
+	amount := min(subtotal-discount+tax, max(order.Amount-refunded, 0))
+
+	baseAmount := amount
+	if order.Amount > 0 && order.BaseAmount > 0 {
+		if baseAmount, err = scaleAmount(order.BaseAmount, amount, order.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	baseCurrency := order.BaseCurrency
+	if baseCurrency == "" {
+		baseCurrency = uc.BaseCurrency
+	}
+
+	return &models.OrderRefund{
+		OrderID:        order.ID,
+		ReturnID:       orderReturn.ID,
+		Status:         constant.RefundStatusPending,
+		Attempt:        1,
+		Subtotal:       subtotal,
+		DiscountAmount: discount,
+		TaxAmount:      tax,
+		Amount:         amount,
+		Currency:       order.Currency,
+		BaseAmount:     baseAmount,
+		BaseCurrency:   baseCurrency,
+	}, nil
+}
+
+// GetOrderReturns get the returns of an order of the user
+func (uc *OrderUseCase) GetOrderReturns(ctx context.Context, orderID int64, userID int64) ([]models.OrderReturnResponse, error) {
+	return uc.OrderService.GetOrderReturns(ctx, orderID, userID)
+}
+
+// RetryOrderRefund request a failed refund again, as long as the refunds of the order that didn't
+// fail leave room for it
+func (uc *OrderUseCase) RetryOrderRefund(ctx context.Context, refundID int64) (*models.OrderRefund, error) {
+	return uc.OrderService.RetryOrderRefund(ctx, refundID, func(refund *models.OrderRefund, order *models.Order, refunded money.Amount) error {
+		if refund.Status != constant.RefundStatusFailed {
+			return fmt.Errorf("%w: refund is %s, only failed refunds can be retried", constant.ErrInvalidRefundRetry, constant.RefundStatusTranslated[refund.Status])
+		}
+
+		if refund.Amount > order.Amount-refunded {
+			return fmt.Errorf("%w: only %s is left to refund on the order", constant.ErrInvalidRefundRetry, max(order.Amount-refunded, 0).String())
+		}
+		return nil
+	})
+}
+
+// ApplyRefundResult move a refund to the status matching a refund result event. Events about
+// unknown refunds are logged and dropped so they don't block the consumer.
+func (uc *OrderUseCase) ApplyRefundResult(ctx context.Context, event *models.RefundResultEvent, status int, eventKey string) error {
+	err := uc.OrderService.ApplyRefundResult(ctx, event.RefundID, max(event.Attempt, 1), status, event.Reason, eventKey)
+	if errors.Is(err, constant.ErrRefundNotFound) {
+		log.Logger.WithFields(logrus.Fields{
+			"event": event,
+			"err":   err.Error(),
+		}).Warn("dropping refund result that cannot be applied")
+		return nil
+	}
+	return err
+}
+
+func validateReturnTransition(from, to int) error {
+	for _, next := range returnStatusTransitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", constant.ErrInvalidReturnStatus, constant.ReturnStatusTranslated[from], constant.ReturnStatusTranslated[to])
+}
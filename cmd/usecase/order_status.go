@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"order_service/infra/constant"
+	"order_service/models"
+	"time"
+)
+
+// orderStatusTransitions lists, for every non-terminal status, the statuses an order is allowed to move to.
+// Statuses that are not a key of this map are terminal.
+var orderStatusTransitions = map[int][]int{
+	constant.OrderStatusCreated: {
+		constant.OrderStatusProcessing,
+		constant.OrderStatusCancelled,
+		constant.OrderStatusFailed,
+	},
+	constant.OrderStatusProcessing: {
+		constant.OrderStatusCompleted,
+		constant.OrderStatusCancelled,
+		constant.OrderStatusFailed,
+	},
+}
+
+// orderStatusGuards hold extra checks that must pass before an order enters the keyed status.
+var orderStatusGuards = map[int]func(order *models.Order, param *models.OrderStatusParam) error{
+	constant.OrderStatusFailed: func(order *models.Order, param *models.OrderStatusParam) error {
+		if param.Reason == "" {
+			return fmt.Errorf("%w: reason is required to fail an order", constant.ErrInvalidStatusRequest)
+		}
+		return nil
+	},
+	constant.OrderStatusCancelled: func(order *models.Order, param *models.OrderStatusParam) error {
+		if param.Reason == "" {
+			return fmt.Errorf("%w: reason is required to cancel an order", constant.ErrInvalidStatusRequest)
+		}
+		return nil
+	},
+}
+
+func isTerminalStatus(status int) bool {
+	_, ok := orderStatusTransitions[status]
+	return !ok
+}
+
+func canTransition(from, to int) bool {
+	for _, next := range orderStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// validateStatusTransition reject the transition when it is not part of the state machine, or return
+// the guard error when the request is missing what the target status needs
+func (uc *OrderUseCase) validateStatusTransition(order *models.Order, param *models.OrderStatusParam) error {
+	from := constant.OrderStatusTranslated[order.Status]
+	to := constant.OrderStatusTranslated[param.Status]
+
+	if isTerminalStatus(order.Status) {
+		return fmt.Errorf("%w: order is already %s", constant.ErrInvalidStatusTransition, from)
+	}
+
+	if !canTransition(order.Status, param.Status) {
+		return fmt.Errorf("%w: %s -> %s", constant.ErrInvalidStatusTransition, from, to)
+	}
+
+	if guard, ok := orderStatusGuards[param.Status]; ok {
+		if err := guard(order, param); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelOrder cancel an order on behalf of its customer. Only orders that are not completed yet
+// and were placed within the cancellation window can be cancelled. Cancelling an already
+// cancelled order returns it unchanged so a retried request succeeds.
+func (uc *OrderUseCase) CancelOrder(ctx context.Context, param *models.OrderStatusParam) (*models.Order, error) {
+	param.Status = constant.OrderStatusCancelled
+	order, err := uc.OrderService.UpdateOrderStatus(ctx, param, func(order *models.Order) error {
+		if order.Status == constant.OrderStatusCancelled {
+			return constant.ErrStatusUnchanged
+		}
+		return uc.checkCancellable(order, param)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uc.releaseOrderStock(ctx, order.ID)
+	uc.settleCheckoutSaga(ctx, order)
+	return order, nil
+}
+
+// checkCancellable reject a customer cancellation of an order that can't be cancelled anymore
+// or was placed before the cancellation window
+func (uc *OrderUseCase) checkCancellable(order *models.Order, param *models.OrderStatusParam) error {
+	if err := uc.validateStatusTransition(order, param); err != nil {
+		return err
+	}
+
+	if time.Since(order.CreateTime) > uc.CancelConfig.Window {
+		return fmt.Errorf("%w: the %s cancellation window has passed", constant.ErrCancellationWindow, uc.CancelConfig.Window)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"fmt"
+	"order_service/config"
+	"order_service/infra/constant"
+	"order_service/models"
+	"order_service/money"
+	"slices"
+	"strings"
+)
+
+// PaymentMethodRegistry hold the payment methods enabled in the config and their rules
+type PaymentMethodRegistry struct {
+	methods []models.PaymentMethod
+	byCode  map[string]models.PaymentMethod
+}
+
+func NewPaymentMethodRegistry(cfg []config.PaymentMethodConfig) (*PaymentMethodRegistry, error) {
+	registry := &PaymentMethodRegistry{
+		methods: []models.PaymentMethod{},
+		byCode:  map[string]models.PaymentMethod{},
+	}
+
+	for _, methodCfg := range cfg {
+		if !methodCfg.Enabled {
+			continue
+		}
+
+		method := models.PaymentMethod{
+			Code: normalizePaymentMethod(methodCfg.Code),
+			Name: methodCfg.Name,
+		}
+
+		if _, ok := registry.byCode[method.Code]; ok {
+			return nil, fmt.Errorf("payment method %s is configured twice", method.Code)
+		}
+
+		for _, code := range methodCfg.Currencies {
+			currency, err := money.ParseCurrency(code)
+			if err != nil {
+				return nil, fmt.Errorf("invalid currency %q of payment method %s: %w", code, method.Code, err)
+			}
+			method.Currencies = append(method.Currencies, currency)
+		}
+
+		var err error
+		if methodCfg.MinAmount != "" {
+			if method.MinAmount, err = money.Parse(methodCfg.MinAmount); err != nil {
+				return nil, fmt.Errorf("invalid min amount of payment method %s: %w", method.Code, err)
+			}
+		}
+
+		if methodCfg.MaxAmount != "" {
+			if method.MaxAmount, err = money.Parse(methodCfg.MaxAmount); err != nil {
+				return nil, fmt.Errorf("invalid max amount of payment method %s: %w", method.Code, err)
+			}
+		}
+
+		registry.methods = append(registry.methods, method)
+		registry.byCode[method.Code] = method
+	}
+	return registry, nil
+}
+
+// Methods return the enabled payment methods in config order
+func (r *PaymentMethodRegistry) Methods() []models.PaymentMethod {
+	return r.methods
+}
+
+// Lookup get an enabled payment method by code
+func (r *PaymentMethodRegistry) Lookup(code string) (models.PaymentMethod, error) {
+	method, ok := r.byCode[normalizePaymentMethod(code)]
+	if !ok {
+		return models.PaymentMethod{}, fmt.Errorf("%w: %q", constant.ErrUnsupportedPayment, code)
+	}
+	return method, nil
+}
+
+// Check check the rules of a payment method against a quoted order
+func (r *PaymentMethodRegistry) Check(method models.PaymentMethod, currency money.Currency, quote *models.CheckoutQuote) error {
+	if len(method.Currencies) > 0 && !slices.Contains(method.Currencies, currency) {
+		return fmt.Errorf("%w: %s does not accept %s", constant.ErrPaymentNotAllowed, method.Code, currency)
+	}
+
+	total := quote.BasePricing.GrandTotal
+	if method.MinAmount > 0 && total < method.MinAmount {
+		return fmt.Errorf("%w: %s requires at least %s", constant.ErrPaymentNotAllowed, method.Code, method.MinAmount)
+	}
+
+	if method.MaxAmount > 0 && total > method.MaxAmount {
+		return fmt.Errorf("%w: %s accepts at most %s", constant.ErrPaymentNotAllowed, method.Code, method.MaxAmount)
+	}
+	return nil
+}
+
+func (uc *OrderUseCase) GetPaymentMethods() []models.PaymentMethod {
+	return uc.PaymentMethods.Methods()
+}
+
+func normalizePaymentMethod(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
@@ -0,0 +1,290 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"order_service/config"
+	"order_service/models"
+	"order_service/money"
+	"strings"
+)
+
+// PricingStage compute one part of an order price breakdown. Stages run in order and
+// each one can read what the previous stages wrote.
+type PricingStage interface {
+	Apply(ctx context.Context, input *models.PricingInput, breakdown *models.PriceBreakdown) error
+}
+
+// PricingPipeline price an order by running its stages one after the other
+type PricingPipeline struct {
+	DefaultRegion string
+	Stages        []PricingStage
+}
+
+// NewPricingPipeline build the subtotal, discount, shipping, tax and grand total stages from the pricing config
+func NewPricingPipeline(cfg config.PricingConfig) (*PricingPipeline, error) {
+	shipping, err := newShippingStage(cfg.Shipping)
+	if err != nil {
+		return nil, err
+	}
+
+	tax, err := newTaxStage(cfg.Tax)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PricingPipeline{
+		DefaultRegion: normalizeRegion(cfg.DefaultRegion),
+		Stages: []PricingStage{
+			subtotalStage{},
+			discountStage{},
+			shipping,
+			tax,
+			grandTotalStage{},
+		},
+	}, nil
+}
+
+// Price run every stage on the input and return the resulting breakdown
+func (p *PricingPipeline) Price(ctx context.Context, input *models.PricingInput) (models.PriceBreakdown, error) {
+	var breakdown models.PriceBreakdown
+	for _, stage := range p.Stages {
+		if err := stage.Apply(ctx, input, &breakdown); err != nil {
+			return models.PriceBreakdown{}, err
+		}
+	}
+	return breakdown, nil
+}
+
+// quoteCheckout price a checkout shipped to region in the order currency and in the catalog currency
+func (uc *OrderUseCase) quoteCheckout(ctx context.Context, items []models.CheckoutItem, discounts []models.AppliedDiscount, rate money.Rate, region string) (*models.CheckoutQuote, error) {
+	input := &models.PricingInput{
+		Items:        items,
+		Discounts:    discounts,
+		ExchangeRate: rate,
+		Region:       region,
+	}
+
+	pricing, err := uc.Pricing.Price(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	input.Base = true
+	basePricing, err := uc.Pricing.Price(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CheckoutQuote{
+		ExchangeRate: rate,
+		Discounts:    discounts,
+		Region:       input.Region,
+		Pricing:      pricing,
+		BasePricing:  basePricing,
+	}, nil
+}
+
+// subtotalStage sum price x quantity of every item
+type subtotalStage struct{}
+
+func (subtotalStage) Apply(ctx context.Context, input *models.PricingInput, breakdown *models.PriceBreakdown) error {
+	var subtotal money.Amount
+	for _, item := range input.Items {
+		price := item.Price
+		if input.Base {
+			price = item.BasePrice
+		}
+
+		lineAmount, err := price.Mul(item.Quantity)
+		if err == nil {
+			subtotal, err = subtotal.Add(lineAmount)
+		}
+
+		if err != nil {
+			return fmt.Errorf("order amount is too large: %w", err)
+		}
+	}
+	breakdown.Subtotal = subtotal
+	return nil
+}
+
+// discountStage sum the applied coupons. Rounding the converted discounts can take them
+// a few cents past the subtotal, so the total is capped there.
+type discountStage struct{}
+
+func (discountStage) Apply(ctx context.Context, input *models.PricingInput, breakdown *models.PriceBreakdown) error {
+	var discount money.Amount
+	for _, applied := range input.Discounts {
+		amount := applied.Amount
+		if input.Base {
+			amount = applied.BaseAmount
+		}
+		discount += amount
+	}
+	breakdown.Discount = min(discount, breakdown.Subtotal)
+	return nil
+}
+
+type shippingZone struct {
+	baseFee  money.Amount
+	perKgFee money.Amount
+}
+
+// shippingStage charge the fee of the zone of the region: a base fee plus a fee per started kg.
+// A free shipping coupon waives it.
+type shippingStage struct {
+	zoneOfRegion map[string]string
+	zones        map[string]shippingZone
+	defaultZone  string
+}
+
+func newShippingStage(cfg config.ShippingConfig) (*shippingStage, error) {
+	stage := &shippingStage{
+		zoneOfRegion: map[string]string{},
+		zones:        map[string]shippingZone{},
+		defaultZone:  cfg.DefaultZone,
+	}
+
+	for _, zoneCfg := range cfg.Zones {
+		baseFee, err := money.Parse(zoneCfg.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base fee of shipping zone %s: %w", zoneCfg.Name, err)
+		}
+
+		var perKgFee money.Amount
+		if zoneCfg.PerKgFee != "" {
+			if perKgFee, err = money.Parse(zoneCfg.PerKgFee); err != nil {
+				return nil, fmt.Errorf("invalid per kg fee of shipping zone %s: %w", zoneCfg.Name, err)
+			}
+		}
+
+		stage.zones[zoneCfg.Name] = shippingZone{baseFee: baseFee, perKgFee: perKgFee}
+		for _, region := range zoneCfg.Regions {
+			stage.zoneOfRegion[normalizeRegion(region)] = zoneCfg.Name
+		}
+	}
+
+	if _, ok := stage.zones[cfg.DefaultZone]; !ok {
+		return nil, fmt.Errorf("default shipping zone %s is not configured", cfg.DefaultZone)
+	}
+	return stage, nil
+}
+
+func (s *shippingStage) Apply(ctx context.Context, input *models.PricingInput, breakdown *models.PriceBreakdown) error {
+	for _, applied := range input.Discounts {
+		if applied.FreeShipping {
+			breakdown.ShippingFee = 0
+			return nil
+		}
+	}
+
+	zoneName, ok := lookupRegion(s.zoneOfRegion, input.Region)
+	if !ok {
+		zoneName = s.defaultZone
+	}
+	zone := s.zones[zoneName]
+
+	var grams int64
+	for _, item := range input.Items {
+		grams += item.Weight * item.Quantity
+	}
+	startedKg := (grams + 999) / 1000
+
+	weightFee, err := zone.perKgFee.Mul(startedKg)
+	if err != nil {
+		return err
+	}
+
+	fee, err := zone.baseFee.Add(weightFee)
+	if err != nil {
+		return err
+	}
+
+	// the fee table is in the catalog currency
+	if !input.Base {
+		if fee, err = money.Convert(fee, input.ExchangeRate); err != nil {
+			return err
+		}
+	}
+	breakdown.ShippingFee = fee
+	return nil
+}
+
+// taxStage charge the tax rate of the region on the discounted subtotal plus shipping
+type taxStage struct {
+	rates       map[string]money.Amount // percentage with two decimals
+	defaultRate money.Amount
+}
+
+func newTaxStage(cfg config.TaxConfig) (*taxStage, error) {
+	defaultRate, err := money.Parse(cfg.DefaultRate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default tax rate: %w", err)
+	}
+
+	stage := &taxStage{
+		rates:       map[string]money.Amount{},
+		defaultRate: defaultRate,
+	}
+	for _, rateCfg := range cfg.Rates {
+		rate, err := money.Parse(rateCfg.Rate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tax rate of region %s: %w", rateCfg.Region, err)
+		}
+		stage.rates[normalizeRegion(rateCfg.Region)] = rate
+	}
+	return stage, nil
+}
+
+func (s *taxStage) Apply(ctx context.Context, input *models.PricingInput, breakdown *models.PriceBreakdown) error {
+	rate, ok := lookupRegion(s.rates, input.Region)
+	if !ok {
+		rate = s.defaultRate
+	}
+
+	taxable := breakdown.Subtotal - breakdown.Discount + breakdown.ShippingFee
+	tax, err := taxable.MulRatio(rate.MinorUnits(), 100*100)
+	if err != nil {
+		return err
+	}
+	breakdown.Tax = tax
+	return nil
+}
+
+// grandTotalStage add the previous stages up
+type grandTotalStage struct{}
+
+func (grandTotalStage) Apply(ctx context.Context, input *models.PricingInput, breakdown *models.PriceBreakdown) error {
+	total, err := (breakdown.Subtotal - breakdown.Discount).Add(breakdown.ShippingFee)
+	if err == nil {
+		total, err = total.Add(breakdown.Tax)
+	}
+
+	if err != nil {
+		return fmt.Errorf("order amount is too large: %w", err)
+	}
+	breakdown.GrandTotal = total
+	return nil
+}
+
+// lookupRegion find the entry of a region, falling back from a subdivision ("ID-JK") to its country ("ID")
+func lookupRegion[V any](entries map[string]V, region string) (V, bool) {
+	if value, ok := entries[region]; ok {
+		return value, true
+	}
+
+	country, _, found := strings.Cut(region, "-")
+	if found {
+		if value, ok := entries[country]; ok {
+			return value, true
+		}
+	}
+
+	var zero V
+	return zero, false
+}
+
+func normalizeRegion(region string) string {
+	return strings.ToUpper(strings.TrimSpace(region))
+}
@@ -0,0 +1,388 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"order_service/infra/constant"
+	"order_service/infra/log"
+	"order_service/models"
+	"time"
+)
+
+// sagaStep is one step of the checkout saga. Execute must be safe to run again for the same
+// saga because a recovered saga re-executes the step it was interrupted in. Compensate undoes a
+// completed step and must be safe to run on a step that was already compensated.
+type sagaStep struct {
+	Name       string
+	Execute    func(ctx context.Context, data *models.CheckoutSagaData) error
+	Compensate func(ctx context.Context, data *models.CheckoutSagaData) error
+}
+
+// checkoutSagaPivotStep is the index of the step that saves the order. Once it completed
+// the order exists and was announced, so a failure later on is retried forward instead of compensated.
+const checkoutSagaPivotStep = 1
+
+func (uc *OrderUseCase) checkoutSagaSteps() []sagaStep {
+	return []sagaStep{
+		{
+			Name: "reserve_stock",
+			Execute: func(ctx context.Context, data *models.CheckoutSagaData) error {
+				return uc.reserveStock(ctx, data.ReservationID, data.Request.Items)
+			},
+			Compensate: func(ctx context.Context, data *models.CheckoutSagaData) error {
+				reservation, err := uc.StockReservations.GetStockReservation(ctx, data.ReservationID)
+				if err != nil {
+					return err
+				}
+
+				if reservation != nil && reservation.Status != constant.StockReservationStatusReleased {
+					uc.releaseStock(ctx, data.ReservationID)
+				}
+				return nil
+			},
+		},
+		{
+			Name: "create_order",
+			Execute: func(ctx context.Context, data *models.CheckoutSagaData) error {
+				// a previous run may have committed the order right before it crashed
+				reservation, err := uc.StockReservations.GetStockReservation(ctx, data.ReservationID)
+				if err != nil {
+					return err
+				}
+
+				if reservation != nil && reservation.OrderID != nil {
+					data.OrderID = *reservation.OrderID
+					return nil
+				}
+
+				order, orderDetail, err := uc.buildOrder(ctx, data)
+				if err != nil {
+					return err
+				}
+
+				orderID, err := uc.OrderService.SaveOrderAndOrderDetail(ctx, order, orderDetail, data.Request.Items, newRequestLog(data), data.ReservationID)
+				if err != nil {
+					return err
+				}
+				data.OrderID = orderID
+				return nil
+			},
+			Compensate: func(ctx context.Context, data *models.CheckoutSagaData) error {
+				// the step was interrupted before the order was committed
+				if data.OrderID == 0 {
+					return nil
+				}
+
+				param := &models.OrderStatusParam{
+					OrderID: data.OrderID,
+					Status:  constant.OrderStatusFailed,
+					Reason:  "checkout rolled back",
+				}
+				_, err := uc.OrderService.UpdateOrderStatus(ctx, param, func(order *models.Order) error {
+					return uc.validateStatusTransition(order, param)
+				})
+				// the order already ended as cancelled or failed, nothing left to undo
+				if errors.Is(err, constant.ErrInvalidStatusTransition) {
+					return nil
+				}
+				return err
+			},
+		},
+		{
+			Name: "confirm_stock",
+			Execute: func(ctx context.Context, data *models.CheckoutSagaData) error {
+				uc.confirmStock(ctx, data.ReservationID)
+				return nil
+			},
+		},
+		{
+			Name: "request_payment",
+			Execute: func(ctx context.Context, data *models.CheckoutSagaData) error {
+				return uc.OrderService.RequestPayment(ctx, data.OrderID, paymentRequestID(data.OrderID))
+			},
+			Compensate: func(ctx context.Context, data *models.CheckoutSagaData) error {
+				// payment voids the charge, or pays it back when it was already captured
+				return uc.OrderService.CancelPayment(ctx, data.OrderID, paymentRequestID(data.OrderID), "checkout rolled back")
+			},
+		},
+	}
+}
+
+// paymentRequestID give the id payment charges an order under, a re-executed payment step
+// sends the same id again so the order is charged once
+func paymentRequestID(orderID int64) string {
+	return fmt.Sprintf("order-%d", orderID)
+}
+
+// startCheckoutSaga persist a new checkout saga and run it until the order awaits payment
+func (uc *OrderUseCase) startCheckoutSaga(ctx context.Context, param *models.CheckoutRequest, quote *models.CheckoutQuote, requestHash string) (*models.CheckoutResponse, error) {
+	now := time.Now()
+	data := &models.CheckoutSagaData{
+		Request:       *param,
+		RequestHash:   requestHash,
+		ExchangeRate:  quote.ExchangeRate,
+		Discounts:     quote.Discounts,
+		Region:        quote.Region,
+		Pricing:       &quote.Pricing,
+		BasePricing:   &quote.BasePricing,
+		ReservationID: uuid.New().String(),
+	}
+
+	saga := &models.CheckoutSaga{
+		ID:         uuid.New().String(),
+		UserID:     param.UserID,
+		Status:     constant.SagaStatusRunning,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	saga.Payload = string(payload)
+
+	if err = uc.OrderService.SaveCheckoutSaga(ctx, saga); err != nil {
+		return nil, err
+	}
+
+	if err = uc.runCheckoutSaga(ctx, saga, data); err != nil {
+		return nil, err
+	}
+
+	return &models.CheckoutResponse{
+		OrderID:        data.OrderID,
+		SagaID:         saga.ID,
+		ResponseStatus: http.StatusCreated,
+	}, nil
+}
+
+// runCheckoutSaga execute the remaining steps from saga.CurrentStep. A failure before the pivot
+// compensates every completed step and returns the step error. A failure after the pivot is
+// recorded and left running for the recoverer.
+func (uc *OrderUseCase) runCheckoutSaga(ctx context.Context, saga *models.CheckoutSaga, data *models.CheckoutSagaData) error {
+	steps := uc.checkoutSagaSteps()
+
+	for saga.CurrentStep < len(steps) {
+		step := steps[saga.CurrentStep]
+
+		err := step.Execute(ctx, data)
+		if err == nil {
+			saga.CurrentStep++
+			err = uc.saveSagaProgress(ctx, saga, data)
+		}
+
+		if err != nil {
+			if saga.CurrentStep > checkoutSagaPivotStep {
+				saga.LastError = err.Error()
+				_ = uc.saveSagaProgress(ctx, saga, data)
+				log.Logger.WithFields(logrus.Fields{
+					"saga_id": saga.ID,
+					"step":    step.Name,
+					"err":     err.Error(),
+				}).Error("checkout saga step failed after the order was saved, leaving it for recovery")
+				return nil
+			}
+
+			if compErr := uc.compensateCheckoutSaga(ctx, saga, data, err); compErr != nil {
+				log.Logger.WithFields(logrus.Fields{
+					"saga_id": saga.ID,
+					"err":     compErr.Error(),
+				}).Error("failed to compensate checkout saga, leaving it for recovery")
+			}
+			return err
+		}
+	}
+
+	saga.Status = constant.SagaStatusAwaitingPayment
+	if err := uc.saveSagaProgress(ctx, saga, data); err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"saga_id": saga.ID,
+			"err":     err.Error(),
+		}).Error("failed to mark checkout saga awaiting payment")
+	}
+	return nil
+}
+
+// compensateCheckoutSaga undo the completed steps in reverse order, persisting after each one
+// so a crash resumes the compensation where it stopped
+func (uc *OrderUseCase) compensateCheckoutSaga(ctx context.Context, saga *models.CheckoutSaga, data *models.CheckoutSagaData, cause error) error {
+	ctx = context.WithoutCancel(ctx)
+	steps := uc.checkoutSagaSteps()
+
+	saga.Status = constant.SagaStatusCompensating
+	if cause != nil {
+		saga.LastError = cause.Error()
+	}
+	if err := uc.saveSagaProgress(ctx, saga, data); err != nil {
+		return err
+	}
+
+	for saga.CurrentStep > 0 {
+		step := steps[saga.CurrentStep-1]
+		if step.Compensate != nil {
+			if err := step.Compensate(ctx, data); err != nil {
+				return err
+			}
+		}
+
+		saga.CurrentStep--
+		if err := uc.saveSagaProgress(ctx, saga, data); err != nil {
+			return err
+		}
+	}
+
+	saga.Status = constant.SagaStatusCompensated
+	return uc.saveSagaProgress(ctx, saga, data)
+}
+
+func (uc *OrderUseCase) saveSagaProgress(ctx context.Context, saga *models.CheckoutSaga, data *models.CheckoutSagaData) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	saga.Payload = string(payload)
+	if data.OrderID > 0 {
+		saga.OrderID = &data.OrderID
+	}
+	saga.UpdateTime = time.Now()
+	return uc.OrderService.UpdateCheckoutSaga(ctx, saga)
+}
+
+// settleCheckoutSaga finish the saga of an order awaiting payment once the order moved on:
+// it completes when the payment went through and is compensated when the order was cancelled or failed
+func (uc *OrderUseCase) settleCheckoutSaga(ctx context.Context, order *models.Order) {
+	saga, err := uc.OrderService.GetCheckoutSagaByOrderID(ctx, order.ID)
+	if err != nil || saga == nil || saga.Status != constant.SagaStatusAwaitingPayment {
+		if err != nil {
+			log.Logger.WithFields(logrus.Fields{
+				"order_id": order.ID,
+				"err":      err.Error(),
+			}).Error("failed to get checkout saga")
+		}
+		return
+	}
+
+	var data models.CheckoutSagaData
+	if err = json.Unmarshal([]byte(saga.Payload), &data); err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"saga_id": saga.ID,
+			"err":     err.Error(),
+		}).Error("failed to decode checkout saga")
+		return
+	}
+
+	switch order.Status {
+	case constant.OrderStatusProcessing:
+		saga.Status = constant.SagaStatusCompleted
+		err = uc.saveSagaProgress(ctx, saga, &data)
+	case constant.OrderStatusCancelled, constant.OrderStatusFailed:
+		err = uc.compensateCheckoutSaga(ctx, saga, &data, errors.New("order "+constant.OrderStatusTranslated[order.Status]))
+	}
+
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"saga_id": saga.ID,
+			"err":     err.Error(),
+		}).Error("failed to settle checkout saga")
+	}
+}
+
+// RecoverCheckoutSagas resume sagas left running or compensating by a crashed instance.
+// A saga that didn't reach the pivot is compensated because its client is gone, one past the
+// pivot runs its remaining steps, and an interrupted compensation continues where it stopped.
+func (uc *OrderUseCase) RecoverCheckoutSagas(ctx context.Context, staleAfter time.Duration, batchSize int) error {
+	sagas, err := uc.OrderService.GetStaleCheckoutSagas(ctx,
+		[]int{constant.SagaStatusRunning, constant.SagaStatusCompensating},
+		time.Now().Add(-staleAfter), batchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range sagas {
+		saga := &sagas[i]
+
+		claimed, err := uc.OrderService.ClaimCheckoutSaga(ctx, saga, time.Now())
+		if err != nil || !claimed {
+			continue
+		}
+
+		if err = uc.recoverCheckoutSaga(ctx, saga); err != nil {
+			log.Logger.WithFields(logrus.Fields{
+				"saga_id": saga.ID,
+				"err":     err.Error(),
+			}).Error("failed to recover checkout saga")
+		}
+	}
+	return nil
+}
+
+func (uc *OrderUseCase) recoverCheckoutSaga(ctx context.Context, saga *models.CheckoutSaga) error {
+	var data models.CheckoutSagaData
+	if err := json.Unmarshal([]byte(saga.Payload), &data); err != nil {
+		return err
+	}
+
+	log.Logger.WithFields(logrus.Fields{
+		"saga_id": saga.ID,
+		"status":  constant.SagaStatusTranslated[saga.Status],
+		"step":    saga.CurrentStep,
+	}).Info("recovering checkout saga")
+
+	if saga.Status == constant.SagaStatusCompensating {
+		return uc.compensateCheckoutSaga(ctx, saga, &data, nil)
+	}
+
+	// the order step is idempotent, re-running it detects an order committed right before the crash
+	if saga.CurrentStep == checkoutSagaPivotStep {
+		reservation, err := uc.StockReservations.GetStockReservation(ctx, data.ReservationID)
+		if err != nil {
+			return err
+		}
+
+		if reservation != nil && reservation.OrderID != nil {
+			data.OrderID = *reservation.OrderID
+			saga.CurrentStep++
+		}
+	}
+
+	if saga.CurrentStep > checkoutSagaPivotStep {
+		return uc.runCheckoutSaga(ctx, saga, &data)
+	}
+
+	// the in-flight step may have run partially, include it in the compensation
+	if saga.CurrentStep < len(uc.checkoutSagaSteps()) {
+		saga.CurrentStep++
+	}
+	return uc.compensateCheckoutSaga(ctx, saga, &data, errors.New("checkout interrupted"))
+}
+
+// GetCheckoutSaga get the progress of a checkout saga of the user
+func (uc *OrderUseCase) GetCheckoutSaga(ctx context.Context, sagaID string, userID int64) (*models.CheckoutSagaResponse, error) {
+	saga, err := uc.OrderService.GetCheckoutSaga(ctx, sagaID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := uc.checkoutSagaSteps()
+	step := "done"
+	if saga.CurrentStep < len(steps) {
+		step = steps[saga.CurrentStep].Name
+	}
+
+	return &models.CheckoutSagaResponse{
+		SagaID:     saga.ID,
+		Status:     constant.SagaStatusTranslated[saga.Status],
+		Step:       step,
+		OrderID:    saga.OrderID,
+		Error:      saga.LastError,
+		CreateTime: saga.CreateTime,
+		UpdateTime: saga.UpdateTime,
+	}, nil
+}
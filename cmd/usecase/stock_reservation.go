@@ -0,0 +1,180 @@
+package usecase
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"order_service/infra/constant"
+	"order_service/infra/log"
+	"order_service/models"
+	"time"
+)
+
+// StockReserver hold product stock for a checkout until the order is saved.
+// A reservation that is neither confirmed nor released expires after its ttl.
+// ReleaseItems give back part of a reserved or confirmed reservation, a later Release gives back the rest.
+type StockReserver interface {
+	Reserve(ctx context.Context, reservationID string, items []models.CheckoutItem, ttl time.Duration) error
+	Confirm(ctx context.Context, reservationID string) error
+	Release(ctx context.Context, reservationID string) error
+	ReleaseItems(ctx context.Context, reservationID string, releaseID string, items []models.StockReservationItem) error
+}
+
+// StockReservationStore keep the local record of every reservation so the sweeper can settle the
+// ones a crashed checkout left behind. service.OrderService implements it.
+type StockReservationStore interface {
+	SaveStockReservation(ctx context.Context, reservation *models.StockReservation) error
+	UpdateStockReservationStatus(ctx context.Context, reservationID string, status int) error
+	GetStockReservation(ctx context.Context, reservationID string) (*models.StockReservation, error)
+	GetStockReservationByOrderID(ctx context.Context, orderID int64) (*models.StockReservation, error)
+	GetPendingStockReservations(ctx context.Context, limit int) ([]models.StockReservationResult, error)
+	UpdateStockItemReleaseStatus(ctx context.Context, releaseID string, status int) error
+	GetPendingStockItemReleases(ctx context.Context, limit int) ([]models.StockItemRelease, error)
+}
+
+// reserveStock record and request a reservation for every checkout item.
+// The local record is written first so the sweeper can release it if the process dies mid checkout.
+// Reserving an id twice is safe, the product service treats the reservation id as idempotency key.
+func (uc *OrderUseCase) reserveStock(ctx context.Context, reservationID string, items []models.CheckoutItem) error {
+	now := time.Now()
+	reservation := &models.StockReservation{
+		ReservationID: reservationID,
+		Status:        constant.StockReservationStatusReserved,
+		ExpireTime:    now.Add(uc.StockConfig.TTL),
+		CreateTime:    now,
+		UpdateTime:    now,
+	}
+
+	if err := uc.StockReservations.SaveStockReservation(ctx, reservation); err != nil {
+		return err
+	}
+
+	if err := uc.StockReserver.Reserve(ctx, reservationID, items, uc.StockConfig.TTL); err != nil {
+		// the product service may have applied part of the reservation before failing
+		uc.releaseStock(ctx, reservationID)
+		return err
+	}
+	return nil
+}
+
+// confirmStock make the reservation of a saved order permanent, the sweeper retries it on failure
+func (uc *OrderUseCase) confirmStock(ctx context.Context, reservationID string) {
+	ctx = context.WithoutCancel(ctx)
+	if err := uc.StockReserver.Confirm(ctx, reservationID); err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"reservation_id": reservationID,
+			"err":            err.Error(),
+		}).Error("failed to confirm stock reservation")
+		return
+	}
+
+	if err := uc.StockReservations.UpdateStockReservationStatus(ctx, reservationID, constant.StockReservationStatusConfirmed); err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"reservation_id": reservationID,
+			"err":            err.Error(),
+		}).Error("failed to mark stock reservation confirmed")
+	}
+}
+
+// releaseStock give the reserved stock back, the sweeper retries it on failure
+func (uc *OrderUseCase) releaseStock(ctx context.Context, reservationID string) {
+	ctx = context.WithoutCancel(ctx)
+	if err := uc.StockReserver.Release(ctx, reservationID); err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"reservation_id": reservationID,
+			"err":            err.Error(),
+		}).Error("failed to release stock reservation")
+		return
+	}
+
+	if err := uc.StockReservations.UpdateStockReservationStatus(ctx, reservationID, constant.StockReservationStatusReleased); err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"reservation_id": reservationID,
+			"err":            err.Error(),
+		}).Error("failed to mark stock reservation released")
+	}
+}
+
+// releaseOrderStock release the stock reservation of a cancelled or failed order
+func (uc *OrderUseCase) releaseOrderStock(ctx context.Context, orderID int64) {
+	reservation, err := uc.StockReservations.GetStockReservationByOrderID(ctx, orderID)
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"order_id": orderID,
+			"err":      err.Error(),
+		}).Error("failed to get stock reservation")
+		return
+	}
+
+	if reservation == nil || reservation.Status == constant.StockReservationStatusReleased {
+		return
+	}
+	uc.releaseStock(ctx, reservation.ReservationID)
+}
+
+// releaseOrderItemsStock give back the stock of units cancelled from an order. The release was
+// recorded with the cancellation, a failure leaves it pending and the sweeper retries it under the
+// same release id. An order without a held reservation has nothing to give back.
+func (uc *OrderUseCase) releaseOrderItemsStock(ctx context.Context, release *models.StockItemRelease) {
+	ctx = context.WithoutCancel(ctx)
+	reservation, err := uc.StockReservations.GetStockReservationByOrderID(ctx, release.OrderID)
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"order_id": release.OrderID,
+			"err":      err.Error(),
+		}).Error("failed to get stock reservation")
+		return
+	}
+
+	if reservation != nil && reservation.Status != constant.StockReservationStatusReleased {
+		err = uc.StockReserver.ReleaseItems(ctx, reservation.ReservationID, release.ReleaseID, release.Items)
+		if err != nil {
+			log.Logger.WithFields(logrus.Fields{
+				"order_id":       release.OrderID,
+				"reservation_id": reservation.ReservationID,
+				"release_id":     release.ReleaseID,
+				"items":          release.Items,
+				"err":            err.Error(),
+			}).Error("failed to release stock of cancelled items")
+			return
+		}
+	}
+
+	if err = uc.StockReservations.UpdateStockItemReleaseStatus(ctx, release.ReleaseID, constant.StockItemReleaseStatusReleased); err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"release_id": release.ReleaseID,
+			"err":        err.Error(),
+		}).Error("failed to update stock release status")
+	}
+}
+
+// SweepStockReservations release abandoned and expired reservations, release the ones of
+// cancelled or failed orders, and confirm the ones of saved orders that were not confirmed yet.
+// It then retries the partial releases of cancelled items that failed.
+func (uc *OrderUseCase) SweepStockReservations(ctx context.Context, batchSize int) error {
+	reservations, err := uc.StockReservations.GetPendingStockReservations(ctx, batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, reservation := range reservations {
+		switch {
+		case reservation.OrderID == nil:
+			uc.releaseStock(ctx, reservation.ReservationID)
+		case reservation.OrderStatus != nil &&
+			(*reservation.OrderStatus == constant.OrderStatusCancelled || *reservation.OrderStatus == constant.OrderStatusFailed):
+			uc.releaseStock(ctx, reservation.ReservationID)
+		default:
+			uc.confirmStock(ctx, reservation.ReservationID)
+		}
+	}
+
+	releases, err := uc.StockReservations.GetPendingStockItemReleases(ctx, batchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range releases {
+		uc.releaseOrderItemsStock(ctx, &releases[i])
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"order_service/cmd/repository"
+	"order_service/config"
+	"order_service/infra/constant"
+	"order_service/infra/log"
+	"order_service/models"
+	"order_service/product"
+	"order_service/product/producttest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetupLogger()
+	os.Exit(m.Run())
+}
+
+// memStockReservations keep reservations in memory and pick the pending ones like the
+// order_stock_reservation query does
+type memStockReservations struct {
+	mu           sync.Mutex
+	reservations map[string]*models.StockReservation
+	orderStatus  map[int64]int
+	itemReleases map[string]*models.StockItemRelease
+}
+
+func newMemStockReservations() *memStockReservations {
+	return &memStockReservations{
+		reservations: map[string]*models.StockReservation{},
+		orderStatus:  map[int64]int{},
+		itemReleases: map[string]*models.StockItemRelease{},
+	}
+}
+
+func (m *memStockReservations) SaveStockReservation(ctx context.Context, reservation *models.StockReservation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := *reservation
+	m.reservations[reservation.ReservationID] = &saved
+	return nil
+}
+
+func (m *memStockReservations) UpdateStockReservationStatus(ctx context.Context, reservationID string, status int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if reservation, ok := m.reservations[reservationID]; ok {
+		reservation.Status = status
+		reservation.UpdateTime = time.Now()
+	}
+	return nil
+}
+
+func (m *memStockReservations) GetStockReservation(ctx context.Context, reservationID string) (*models.StockReservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reservation, ok := m.reservations[reservationID]
+	if !ok {
+		return nil, nil
+	}
+	found := *reservation
+	return &found, nil
+}
+
+func (m *memStockReservations) GetStockReservationByOrderID(ctx context.Context, orderID int64) (*models.StockReservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, reservation := range m.reservations {
+		if reservation.OrderID != nil && *reservation.OrderID == orderID {
+			found := *reservation
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memStockReservations) GetPendingStockReservations(ctx context.Context, limit int) ([]models.StockReservationResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var pending []models.StockReservationResult
+	for _, reservation := range m.reservations {
+		result := models.StockReservationResult{StockReservation: *reservation}
+		if reservation.OrderID != nil {
+			if status, ok := m.orderStatus[*reservation.OrderID]; ok {
+				result.OrderStatus = &status
+			}
+		}
+
+		orderGone := result.OrderStatus != nil &&
+			(*result.OrderStatus == constant.OrderStatusCancelled || *result.OrderStatus == constant.OrderStatusFailed)
+		switch {
+		case reservation.Status == constant.StockReservationStatusReserved && (reservation.OrderID != nil || reservation.ExpireTime.Before(now)):
+			pending = append(pending, result)
+		case reservation.Status != constant.StockReservationStatusReleased && orderGone:
+			pending = append(pending, result)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreateTime.Before(pending[j].CreateTime)
+	})
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (m *memStockReservations) UpdateStockItemReleaseStatus(ctx context.Context, releaseID string, status int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if release, ok := m.itemReleases[releaseID]; ok {
+		release.Status = status
+		release.UpdateTime = time.Now()
+	}
+	return nil
+}
+
+func (m *memStockReservations) GetPendingStockItemReleases(ctx context.Context, limit int) ([]models.StockItemRelease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []models.StockItemRelease
+	for _, release := range m.itemReleases {
+		if release.Status == constant.StockItemReleaseStatusPending {
+			pending = append(pending, *release)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreateTime.Before(pending[j].CreateTime)
+	})
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+// addItemRelease record a pending partial release like the item cancellation transaction does
+func (m *memStockReservations) addItemRelease(orderID int64, releaseID string, items []models.StockReservationItem) *models.StockItemRelease {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	release := &models.StockItemRelease{
+		ReleaseID:  releaseID,
+		OrderID:    orderID,
+		Items:      items,
+		Status:     constant.StockItemReleaseStatusPending,
+		CreateTime: time.Now(),
+	}
+	m.itemReleases[releaseID] = release
+	found := *release
+	return &found
+}
+
+func (m *memStockReservations) itemReleaseStatus(releaseID string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.itemReleases[releaseID].Status
+}
+
+func (m *memStockReservations) status(reservationID string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reservations[reservationID].Status
+}
+
+func newStockTestUseCase(t *testing.T) (*OrderUseCase, *memStockReservations, *producttest.Server) {
+	server := producttest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddProduct(models.Product{ID: 1, Name: "keyboard"}, 10)
+	server.AddProduct(models.Product{ID: 2, Name: "mouse"}, 10)
+
+	store := newMemStockReservations()
+	uc := &OrderUseCase{
+		StockReserver:     repository.NewProductStockReserver(product.NewClient(server.Config())),
+		StockReservations: store,
+		StockConfig:       config.StockReservationConfig{TTL: 15 * time.Minute, SweepBatch: 100},
+	}
+	return uc, store, server
+}
+
+func TestReserveStock(t *testing.T) {
+	uc, store, server := newStockTestUseCase(t)
+
+	items := []models.CheckoutItem{{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 3}}
+	if err := uc.reserveStock(context.Background(), "res-1", items); err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Stock(1) != 8 || server.Stock(2) != 7 {
+		t.Fatalf("stock = %d, %d, want 8, 7", server.Stock(1), server.Stock(2))
+	}
+	if status := store.status("res-1"); status != constant.StockReservationStatusReserved {
+		t.Fatalf("local status = %d, want reserved", status)
+	}
+}
+
+func TestReserveStockReleasesOnFailure(t *testing.T) {
+	uc, store, server := newStockTestUseCase(t)
+
+	// the product service applies the reservation but the answer is lost
+	server.ReserveFailure = 500
+	if err := uc.reserveStock(context.Background(), "res-1", []models.CheckoutItem{{ProductID: 1, Quantity: 4}}); err == nil {
+		t.Fatal("reserveStock succeeded, want an error")
+	}
+
+	if server.Stock(1) != 10 {
+		t.Fatalf("stock = %d, want 10 after the release", server.Stock(1))
+	}
+	if status := server.Reservation("res-1").Status; status != producttest.ReservationReleased {
+		t.Fatalf("product service status = %s, want released", status)
+	}
+	if status := store.status("res-1"); status != constant.StockReservationStatusReleased {
+		t.Fatalf("local status = %d, want released", status)
+	}
+}
+
+func TestReserveStockInsufficient(t *testing.T) {
+	uc, store, server := newStockTestUseCase(t)
+
+	err := uc.reserveStock(context.Background(), "res-1", []models.CheckoutItem{{ProductID: 2, Quantity: 11}})
+	if !errors.Is(err, constant.ErrInsufficientStock) {
+		t.Fatalf("reserveStock error = %v, want ErrInsufficientStock", err)
+	}
+
+	// nothing is held and the local record is released too, so the sweeper skips it
+	if server.Stock(2) != 10 {
+		t.Fatalf("stock = %d, want 10", server.Stock(2))
+	}
+	if status := store.status("res-1"); status != constant.StockReservationStatusReleased {
+		t.Fatalf("local status = %d, want released", status)
+	}
+}
+
+func TestSweepStockReservations(t *testing.T) {
+	uc, store, server := newStockTestUseCase(t)
+	ctx := context.Background()
+
+	reserve := func(reservationID string, productID int64, qty int64, orderID *int64) {
+		t.Helper()
+		if err := uc.reserveStock(ctx, reservationID, []models.CheckoutItem{{ProductID: productID, Quantity: qty}}); err != nil {
+			t.Fatal(err)
+		}
+		store.mu.Lock()
+		store.reservations[reservationID].OrderID = orderID
+		store.mu.Unlock()
+	}
+
+	savedOrder, cancelledOrder := int64(100), int64(101)
+	store.orderStatus[savedOrder] = constant.OrderStatusCreated
+	store.orderStatus[cancelledOrder] = constant.OrderStatusCancelled
+
+	reserve("abandoned", 1, 3, nil) // checkout died before saving the order
+	store.reservations["abandoned"].ExpireTime = time.Now().Add(-time.Minute)
+	reserve("in-flight", 1, 2, nil) // checkout still running
+	reserve("saved", 2, 1, &savedOrder)
+	reserve("cancelled", 2, 4, &cancelledOrder)
+
+	if err := uc.SweepStockReservations(ctx, uc.StockConfig.SweepBatch); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		reservationID string
+		local         int
+		remote        string
+	}{
+		{reservationID: "abandoned", local: constant.StockReservationStatusReleased, remote: producttest.ReservationReleased},
+		{reservationID: "in-flight", local: constant.StockReservationStatusReserved, remote: producttest.ReservationReserved},
+		{reservationID: "saved", local: constant.StockReservationStatusConfirmed, remote: producttest.ReservationConfirmed},
+		{reservationID: "cancelled", local: constant.StockReservationStatusReleased, remote: producttest.ReservationReleased},
+	}
+	for _, tt := range tests {
+		if status := store.status(tt.reservationID); status != tt.local {
+			t.Errorf("%s local status = %d, want %d", tt.reservationID, status, tt.local)
+		}
+		if status := server.Reservation(tt.reservationID).Status; status != tt.remote {
+			t.Errorf("%s product service status = %s, want %s", tt.reservationID, status, tt.remote)
+		}
+	}
+
+	// only the in-flight and the saved reservations still hold stock
+	if server.Stock(1) != 8 || server.Stock(2) != 9 {
+		t.Fatalf("stock = %d, %d, want 8, 9", server.Stock(1), server.Stock(2))
+	}
+
+	// a second sweep has nothing left to do
+	calls := len(server.Calls())
+	if err := uc.SweepStockReservations(ctx, uc.StockConfig.SweepBatch); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.Calls()) != calls {
+		t.Fatalf("second sweep called the product service: %v", server.Calls()[calls:])
+	}
+}
+
+func TestReleaseOrderStock(t *testing.T) {
+	uc, store, server := newStockTestUseCase(t)
+	ctx := context.Background()
+
+	orderID := int64(100)
+	if err := uc.reserveStock(ctx, "res-1", []models.CheckoutItem{{ProductID: 1, Quantity: 5}}); err != nil {
+		t.Fatal(err)
+	}
+	store.reservations["res-1"].OrderID = &orderID
+	uc.confirmStock(ctx, "res-1")
+
+	uc.releaseOrderStock(ctx, orderID)
+	if server.Stock(1) != 10 {
+		t.Fatalf("stock after cancel = %d, want 10", server.Stock(1))
+	}
+
+	// releasing again makes no call
+	calls := len(server.Calls())
+	uc.releaseOrderStock(ctx, orderID)
+	if len(server.Calls()) != calls {
+		t.Fatalf("second release called the product service: %v", server.Calls()[calls:])
+	}
+}
+
+func TestReleaseOrderItemsStock(t *testing.T) {
+	uc, store, server := newStockTestUseCase(t)
+	ctx := context.Background()
+
+	orderID := int64(100)
+	if err := uc.reserveStock(ctx, "res-1", []models.CheckoutItem{{ProductID: 1, Quantity: 5}}); err != nil {
+		t.Fatal(err)
+	}
+	store.reservations["res-1"].OrderID = &orderID
+	uc.confirmStock(ctx, "res-1")
+
+	release := store.addItemRelease(orderID, "order-100-items-1-v1", []models.StockReservationItem{{ProductID: 1, Quantity: 2}})
+	uc.releaseOrderItemsStock(ctx, release)
+	if server.Stock(1) != 7 {
+		t.Fatalf("stock after partial cancel = %d, want 7", server.Stock(1))
+	}
+	if status := store.itemReleaseStatus(release.ReleaseID); status != constant.StockItemReleaseStatusReleased {
+		t.Fatalf("release status = %d, want released", status)
+	}
+
+	// a failed release stays pending and the sweeper retries it under the same id
+	server.ReleaseItemsFailure = 500
+	release = store.addItemRelease(orderID, "order-100-items-1-v2", []models.StockReservationItem{{ProductID: 1, Quantity: 1}})
+	uc.releaseOrderItemsStock(ctx, release)
+	if status := store.itemReleaseStatus(release.ReleaseID); status != constant.StockItemReleaseStatusPending {
+		t.Fatalf("release status after a failure = %d, want pending", status)
+	}
+
+	if err := uc.SweepStockReservations(ctx, uc.StockConfig.SweepBatch); err != nil {
+		t.Fatal(err)
+	}
+	if server.Stock(1) != 8 {
+		t.Fatalf("stock after the retry = %d, want 8", server.Stock(1))
+	}
+	if status := store.itemReleaseStatus(release.ReleaseID); status != constant.StockItemReleaseStatusReleased {
+		t.Fatalf("release status after the retry = %d, want released", status)
+	}
+
+	// cancelling the rest of the order gives back only what is still held
+	uc.releaseOrderStock(ctx, orderID)
+	if server.Stock(1) != 10 {
+		t.Fatalf("stock after cancel = %d, want 10", server.Stock(1))
+	}
+}
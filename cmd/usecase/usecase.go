@@ -2,85 +2,175 @@ package usecase
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/sirupsen/logrus"
 	"order_service/cmd/service"
+	"order_service/config"
 	"order_service/infra/constant"
-	"order_service/kafka"
+	"order_service/infra/log"
+	"order_service/infra/utils"
 	"order_service/models"
-	"time"
+	"order_service/money"
+	"order_service/product"
+	"strings"
 )
 
 type OrderUseCase struct {
-	OrderService  service.OrderService
-	KafkaProducer kafka.KafkaProducer
+	OrderService      service.OrderService
+	StockReserver     StockReserver
+	StockReservations StockReservationStore
+	RateProvider      RateProvider
+	Pricing           *PricingPipeline
+	PaymentMethods    *PaymentMethodRegistry
+	StockConfig       config.StockReservationConfig
+	AddressConfig     config.AddressConfig
+	CancelConfig      config.CancellationConfig
+	IdempotencyConfig config.IdempotencyConfig
+	BaseCurrency      money.Currency
 }
 
-func NewOrderUseCase(orderService service.OrderService, kafkaProducer kafka.KafkaProducer) *OrderUseCase {
-	return &OrderUseCase{
-		OrderService:  orderService,
-		KafkaProducer: kafkaProducer,
+func NewOrderUseCase(orderService service.OrderService, stockReserver StockReserver, rateProvider RateProvider, pricing *PricingPipeline, paymentMethods *PaymentMethodRegistry, stockConfig config.StockReservationConfig, currencyConfig config.CurrencyConfig, addressConfig config.AddressConfig, cancelConfig config.CancellationConfig, idempotencyConfig config.IdempotencyConfig) *OrderUseCase {
+	uc := &OrderUseCase{
+		OrderService:      orderService,
+		StockReserver:     stockReserver,
+		RateProvider:      rateProvider,
+		Pricing:           pricing,
+		PaymentMethods:    paymentMethods,
+		StockConfig:       stockConfig,
+		AddressConfig:     addressConfig,
+		CancelConfig:      cancelConfig,
+		IdempotencyConfig: idempotencyConfig,
+		BaseCurrency:      money.Currency(strings.ToUpper(currencyConfig.Base)),
 	}
+	uc.StockReservations = &uc.OrderService
+	return uc
 }
 
-func (uc *OrderUseCase) CheckOutOrder(ctx context.Context, param *models.CheckoutRequest) (int64, error) {
+func (uc *OrderUseCase) CheckOutOrder(ctx context.Context, param *models.CheckoutRequest) (*models.CheckoutResponse, error) {
 	if param.IdempotencyToken != "" {
-		isExists, err := uc.OrderService.CheckIdempotency(ctx, param.IdempotencyToken)
-		if err != nil {
-			return 0, err
+		return uc.checkOutIdempotent(ctx, param)
+	}
+
+	// validate products and price them in the order currency
+	quote, err := uc.validateCheckout(ctx, param)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reserve stock, save the order and confirm the stock as a saga so every step is compensated on failure
+	return uc.startCheckoutSaga(ctx, param, quote, "")
+}
+
+// buildOrder construct the order and order detail rows of a validated checkout request
+func (uc *OrderUseCase) buildOrder(ctx context.Context, data *models.CheckoutSagaData) (*models.Order, *models.OrderDetail, error) {
+	param := &data.Request
+	rate := data.ExchangeRate
+
+	// sagas persisted before multi-currency carry no rate, their prices are in the base currency
+	if rate == 0 {
+		rate = money.IdentityRate
+		param.Currency = uc.BaseCurrency
+		for i := range param.Items {
+			param.Items[i].BasePrice = param.Items[i].Price
 		}
+	}
 
-		if isExists {
-			return 0, fmt.Errorf("order with idempotency token '%s' already processed", param.IdempotencyToken)
+	// sagas persisted before the pricing pipeline are priced now
+	if data.Pricing == nil || data.BasePricing == nil {
+		quote, err := uc.quoteCheckout(ctx, param.Items, data.Discounts, rate, uc.pricingRegion(param))
+		if err != nil {
+			return nil, nil, err
 		}
+		data.Region, data.Pricing, data.BasePricing = quote.Region, &quote.Pricing, &quote.BasePricing
 	}
 
-	// validate products
-	if err := uc.validateProducts(ctx, param.Items); err != nil {
-		return 0, err
+	totalQty, _, _, err := uc.calculateOrderSummary(param.Items)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	totalQty, totalAmount := uc.calculateOrderSummary(param.Items)
-	products, orderHistory := uc.constructOrderDetail(param.Items)
+	discounts := data.Discounts
+	if discounts == nil {
+		discounts = []models.AppliedDiscount{}
+	}
 
 	orderDetail := &models.OrderDetail{
-		Products:     products,
-		OrderHistory: orderHistory,
+		Discounts: discounts,
 	}
 
 	order := &models.Order{
-		UserID:          param.UserID,
-		Amount:          totalAmount,
-		TotalQty:        int(totalQty),
-		Status:          constant.OrderStatusCreated,
-		PaymentMethod:   param.PaymentMethod,
-		ShippingAddress: param.ShippingAddress,
+		UserID:                param.UserID,
+		Amount:                data.Pricing.GrandTotal,
+		Currency:              param.Currency,
+		Subtotal:              data.Pricing.Subtotal,
+		DiscountAmount:        data.Pricing.Discount,
+		ShippingFee:           data.Pricing.ShippingFee,
+		TaxAmount:             data.Pricing.Tax,
+		PricingRegion:         data.Region,
+		BaseAmount:            data.BasePricing.GrandTotal,
+		BaseCurrency:          uc.BaseCurrency,
+		ExchangeRate:          rate,
+		TotalQty:              int(totalQty),
+		Status:                constant.OrderStatusCreated,
+		PaymentMethod:         param.PaymentMethod,
+		ShippingAddress:       param.ShippingAddress.String(),
+		ShippingAddressDetail: param.ShippingAddress.Address,
 	}
+	return order, orderDetail, nil
+}
 
-	// Save order and order detail, and handle idempotency token and Kafka event
-	orderID, err := uc.OrderService.SaveOrderAndOrderDetail(ctx, order, orderDetail, param.IdempotencyToken, uc.KafkaProducer)
+// validateCheckout validate a checkout and quote it: products are priced in the requested currency,
+// coupons are applied and the pricing pipeline adds shipping and tax. The quote is snapshotted
+// on the saga so the order is saved with it.
+func (uc *OrderUseCase) validateCheckout(ctx context.Context, param *models.CheckoutRequest) (*models.CheckoutQuote, error) {
+	paymentMethod, err := uc.PaymentMethods.Lookup(param.PaymentMethod)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	param.PaymentMethod = paymentMethod.Code
 
-	return orderID, nil
-}
+	if err = uc.resolveShippingAddress(ctx, param); err != nil {
+		return nil, err
+	}
 
-func (uc *OrderUseCase) validateProducts(ctx context.Context, items []models.CheckoutItem) error {
-	seen := map[int64]bool{}
-	for i := range items {
-		item := &items[i]
+	if err := uc.validateProducts(ctx, param.Items); err != nil {
+		return nil, err
+	}
 
-		productDetail, err := uc.OrderService.GetProductInfo(ctx, item.ProductID)
-		if err != nil {
-			return err
-		}
+	rate, err := uc.priceInCurrency(ctx, param)
+	if err != nil {
+		return nil, err
+	}
 
-		if productDetail == (models.Product{}) {
-			return errors.New("invalid Product ID")
-		}
+	// reject carts whose total can't be represented before anything is reserved
+	_, _, baseSubtotal, err := uc.calculateOrderSummary(param.Items)
+	if err != nil {
+		return nil, err
+	}
 
+	discounts, err := uc.applyCoupons(ctx, param, baseSubtotal, rate)
+	if err != nil {
+		return nil, err
+	}
+
+	// add shipping and tax on top of the discounted subtotal
+	quote, err := uc.quoteCheckout(ctx, param.Items, discounts, rate, uc.pricingRegion(param))
+	if err != nil {
+		return nil, err
+	}
+
+	// the currency and amount rules of the payment method apply to the final price
+	if err = uc.PaymentMethods.Check(paymentMethod, param.Currency, quote); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+func (uc *OrderUseCase) validateProducts(ctx context.Context, items []models.CheckoutItem) error {
+	seen := map[int64]bool{}
+	productIds := make([]int64, 0, len(items))
+	for _, item := range items {
 		if seen[item.ProductID] {
 			return errors.New("duplicate product in checkout")
 		}
@@ -90,11 +180,27 @@ func (uc *OrderUseCase) validateProducts(ctx context.Context, items []models.Che
 		if item.Quantity <= 0 {
 			return errors.New("quantity must be greater than zero")
 		}
+		productIds = append(productIds, item.ProductID)
+	}
+
+	products, err := uc.OrderService.GetProductsInfo(ctx, productIds)
+	if err != nil {
+		return err
+	}
+
+	for i := range items {
+		item := &items[i]
+
+		productDetail, ok := products[item.ProductID]
+		if !ok {
+			return fmt.Errorf("%w: %d", product.ErrProductNotFound, item.ProductID)
+		}
 
 		if productDetail.Price <= 0 {
 			return errors.New("price must be greater than zero")
 		}
 		item.Price = productDetail.Price
+		item.Weight = productDetail.Weight
 
 		if item.Quantity > productDetail.Stock {
 			return errors.New("invalid product qty")
@@ -103,31 +209,122 @@ func (uc *OrderUseCase) validateProducts(ctx context.Context, items []models.Che
 	return nil
 }
 
-func (uc *OrderUseCase) calculateOrderSummary(items []models.CheckoutItem) (int64, float64) {
+// calculateOrderSummary sum the quantity, the amount in the order currency and the amount in the base currency
+// of the items. Amounts are integer minor units so the totals are exact whatever the size of the cart.
+func (uc *OrderUseCase) calculateOrderSummary(items []models.CheckoutItem) (int64, money.Amount, money.Amount, error) {
 	var totalQty int64
-	var totalAmount float64
+	var totalAmount, baseAmount money.Amount
 
 	for _, item := range items {
+		lineAmount, err := item.Price.Mul(item.Quantity)
+		if err == nil {
+			totalAmount, err = totalAmount.Add(lineAmount)
+		}
+
+		var baseLineAmount money.Amount
+		if err == nil {
+			baseLineAmount, err = item.BasePrice.Mul(item.Quantity)
+		}
+
+		if err == nil {
+			baseAmount, err = baseAmount.Add(baseLineAmount)
+		}
+
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("order amount is too large: %w", err)
+		}
 		totalQty += item.Quantity
-		totalAmount += item.Price * float64(item.Quantity)
 	}
-	return totalQty, totalAmount
+	return totalQty, totalAmount, baseAmount, nil
 }
 
-func (uc *OrderUseCase) constructOrderDetail(items []models.CheckoutItem) (string, string) {
-	orderDetail, _ := json.Marshal(items)
-	orderHistory := []map[string]interface{}{
-		{"status": "created", "timestamp": time.Now()},
+// GetOrderHistoryByUserId get a page of the user's orders and the cursor of the next page
+func (uc *OrderUseCase) GetOrderHistoryByUserId(ctx context.Context, param *models.OrderHistoryParam) (*models.OrderHistoryPage, error) {
+	if param.Limit <= 0 {
+		param.Limit = constant.OrderHistoryDefaultLimit
 	}
 
-	orderHistoryJson, _ := json.Marshal(orderHistory)
-	return string(orderDetail), string(orderHistoryJson)
-}
+	if param.Limit > constant.OrderHistoryMaxLimit {
+		param.Limit = constant.OrderHistoryMaxLimit
+	}
 
-func (uc *OrderUseCase) GetOrderHistoryByUserId(ctx context.Context, param *models.OrderHistoryParam) ([]models.OrderHistoryResponse, error) {
+	// fetch one extra row to know whether there is a next page
+	pageSize := param.Limit
+	param.Limit = pageSize + 1
 	orderHistories, err := uc.OrderService.GetOrderHistoryByUserId(ctx, param)
+	param.Limit = pageSize
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.OrderHistoryPage{
+		Orders: orderHistories,
+	}
+
+	if len(orderHistories) > pageSize {
+		page.Orders = orderHistories[:pageSize]
+		page.NextCursor = utils.EncodeCursor(page.Orders[pageSize-1].OrderID)
+	}
+
+	if page.Orders == nil {
+		page.Orders = []models.OrderHistoryResponse{}
+	}
+	return page, nil
+}
+
+func (uc *OrderUseCase) GetOrderDetailByID(ctx context.Context, orderID int64, userID int64) (*models.OrderDetailResponse, error) {
+	orderDetail, err := uc.OrderService.GetOrderDetailByID(ctx, orderID, userID)
 	if err != nil {
 		return nil, err
 	}
-	return orderHistories, nil
+
+	items, err := uc.OrderService.GetOrderItems(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	orderDetail.Items = toOrderItemResponses(items)
+	return orderDetail, nil
+}
+
+// UpdateOrderStatus move an order through the status state machine, rejecting illegal transitions
+func (uc *OrderUseCase) UpdateOrderStatus(ctx context.Context, param *models.OrderStatusParam) (*models.Order, error) {
+	order, err := uc.OrderService.UpdateOrderStatus(ctx, param, func(order *models.Order) error {
+		return uc.validateStatusTransition(order, param)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status == constant.OrderStatusCancelled || order.Status == constant.OrderStatusFailed {
+		uc.releaseOrderStock(ctx, order.ID)
+	}
+
+	uc.settleCheckoutSaga(ctx, order)
+	return order, nil
+}
+
+// ApplyPaymentResult move the order to the status matching a payment result event.
+// Redelivered events are skipped through eventKey, and events that can never be applied
+// (unknown order, illegal transition) are logged and dropped so they don't block the consumer.
+func (uc *OrderUseCase) ApplyPaymentResult(ctx context.Context, event *models.PaymentResultEvent, status int, eventKey string) error {
+	param := &models.OrderStatusParam{
+		OrderID:  event.OrderID,
+		Status:   status,
+		Reason:   event.Reason,
+		EventKey: eventKey,
+	}
+
+	if status == constant.OrderStatusFailed && param.Reason == "" {
+		param.Reason = "payment failed"
+	}
+
+	_, err := uc.UpdateOrderStatus(ctx, param)
+	if errors.Is(err, constant.ErrOrderNotFound) || errors.Is(err, constant.ErrInvalidStatusTransition) {
+		log.Logger.WithFields(logrus.Fields{
+			"param": param,
+			"err":   err.Error(),
+		}).Warn("dropping payment result that cannot be applied")
+		return nil
+	}
+	return err
 }
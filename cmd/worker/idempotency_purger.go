@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"order_service/cmd/service"
+	"order_service/config"
+	"order_service/infra/log"
+	"time"
+)
+
+type IdempotencyPurger struct {
+	OrderService service.OrderService
+	Config       config.IdempotencyConfig
+}
+
+func NewIdempotencyPurger(orderService service.OrderService, cfg config.IdempotencyConfig) *IdempotencyPurger {
+	return &IdempotencyPurger{
+		OrderService: orderService,
+		Config:       cfg,
+	}
+}
+
+// Run delete idempotency records past their retention on every tick until ctx is cancelled
+func (w *IdempotencyPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Config.PurgeInterval)
+	defer ticker.Stop()
+
+	log.Logger.Info("idempotency purger started")
+	for {
+		select {
+		case <-ctx.Done():
+			log.Logger.Info("idempotency purger stopped")
+			return
+		case <-ticker.C:
+			w.purge(ctx)
+		}
+	}
+}
+
+// purge keep deleting full batches so a large backlog doesn't take many ticks
+func (w *IdempotencyPurger) purge(ctx context.Context) {
+	for ctx.Err() == nil {
+		deleted, err := w.OrderService.PurgeIdempotency(ctx, w.Config.RequestLogRetention, w.Config.PurgeBatch)
+		if err != nil {
+			log.Logger.WithFields(logrus.Fields{
+				"err": err.Error(),
+			}).Error("failed to purge idempotency records")
+			return
+		}
+
+		if deleted > 0 {
+			log.Logger.WithFields(logrus.Fields{
+				"deleted": deleted,
+			}).Info("purged idempotency records")
+		}
+
+		if deleted < int64(w.Config.PurgeBatch) {
+			return
+		}
+	}
+}
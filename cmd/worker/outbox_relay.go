@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"order_service/cmd/service"
+	"order_service/config"
+	"order_service/infra/log"
+	"order_service/kafka"
+	"order_service/models"
+	"time"
+)
+
+type OutboxRelay struct {
+	OrderService  service.OrderService
+	KafkaProducer kafka.KafkaProducer
+	Config        config.OutboxConfig
+}
+
+func NewOutboxRelay(orderService service.OrderService, kafkaProducer kafka.KafkaProducer, cfg config.OutboxConfig) *OutboxRelay {
+	return &OutboxRelay{
+		OrderService:  orderService,
+		KafkaProducer: kafkaProducer,
+		Config:        cfg,
+	}
+}
+
+// Run poll the outbox and publish pending events until ctx is cancelled
+func (w *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Config.PollInterval)
+	defer ticker.Stop()
+
+	log.Logger.Info("outbox relay started")
+	for {
+		select {
+		case <-ctx.Done():
+			log.Logger.Info("outbox relay stopped")
+			return
+		case <-ticker.C:
+			w.relay(ctx)
+		}
+	}
+}
+
+// Flush publish what is left in the outbox once more, it is called on shutdown after Run returned
+// so events written by the last requests don't wait for the next start
+func (w *OutboxRelay) Flush(ctx context.Context) {
+	w.relay(ctx)
+}
+
+// relay keep publishing batches until no event is due. A batch holds one event per message key,
+// so a burst on one order drains over several batches.
+func (w *OutboxRelay) relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		sent, err := w.OrderService.RelayOutbox(ctx, w.Config.BatchSize, w.Config.ClaimTTL, w.publish, w.backoff)
+		if err != nil {
+			log.Logger.WithFields(logrus.Fields{
+				"err": err.Error(),
+			}).Error("failed to relay outbox")
+			return
+		}
+
+		if sent == 0 {
+			return
+		}
+	}
+}
+
+func (w *OutboxRelay) publish(ctx context.Context, outbox *models.OrderOutbox) error {
+	return w.KafkaProducer.Publish(ctx, outbox.Topic, outbox.MessageKey, []byte(outbox.Payload))
+}
+
+// backoff double the wait after every failed attempt, capped at MaxBackoff
+func (w *OutboxRelay) backoff(attempts int) time.Duration {
+	wait := w.Config.BaseBackoff
+	for i := 1; i < attempts && wait < w.Config.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > w.Config.MaxBackoff {
+		wait = w.Config.MaxBackoff
+	}
+	return wait
+}
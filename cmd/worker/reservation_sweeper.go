@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"order_service/cmd/usecase"
+	"order_service/config"
+	"order_service/infra/log"
+	"time"
+)
+
+type ReservationSweeper struct {
+	OrderUseCase usecase.OrderUseCase
+	Config       config.StockReservationConfig
+}
+
+func NewReservationSweeper(orderUseCase usecase.OrderUseCase, cfg config.StockReservationConfig) *ReservationSweeper {
+	return &ReservationSweeper{
+		OrderUseCase: orderUseCase,
+		Config:       cfg,
+	}
+}
+
+// Run settle pending stock reservations on every tick until ctx is cancelled
+func (w *ReservationSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Config.SweepInterval)
+	defer ticker.Stop()
+
+	log.Logger.Info("reservation sweeper started")
+	for {
+		select {
+		case <-ctx.Done():
+			log.Logger.Info("reservation sweeper stopped")
+			return
+		case <-ticker.C:
+			if err := w.OrderUseCase.SweepStockReservations(ctx, w.Config.SweepBatch); err != nil {
+				log.Logger.WithFields(logrus.Fields{
+					"err": err.Error(),
+				}).Error("failed to sweep stock reservations")
+			}
+		}
+	}
+}
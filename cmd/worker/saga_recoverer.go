@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"order_service/cmd/usecase"
+	"order_service/config"
+	"order_service/infra/log"
+	"time"
+)
+
+type SagaRecoverer struct {
+	OrderUseCase usecase.OrderUseCase
+	Config       config.CheckoutSagaConfig
+}
+
+func NewSagaRecoverer(orderUseCase usecase.OrderUseCase, cfg config.CheckoutSagaConfig) *SagaRecoverer {
+	return &SagaRecoverer{
+		OrderUseCase: orderUseCase,
+		Config:       cfg,
+	}
+}
+
+// Run resume stale checkout sagas on every tick until ctx is cancelled
+func (w *SagaRecoverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Config.RecoverInterval)
+	defer ticker.Stop()
+
+	log.Logger.Info("saga recoverer started")
+	for {
+		select {
+		case <-ctx.Done():
+			log.Logger.Info("saga recoverer stopped")
+			return
+		case <-ticker.C:
+			if err := w.OrderUseCase.RecoverCheckoutSagas(ctx, w.Config.StaleAfter, w.Config.RecoverBatch); err != nil {
+				log.Logger.WithFields(logrus.Fields{
+					"err": err.Error(),
+				}).Error("failed to recover checkout sagas")
+			}
+		}
+	}
+}
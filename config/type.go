@@ -1,27 +1,153 @@
 package config
 
+import "time"
+
 type Config struct {
-	App            AppConfig      `mapstructure:"app" validate:"required"`
-	Database       DatabaseConfig `mapstructure:"database" validate:"required"`
-	Redis          RedisConfig    `mapstructure:"redis" validate:"required"`
-	Secrete        SecretConfig   `mapstructure:"secrete" validate:"required"`
-	ProductService ProductService `mapstructure:"product_service" validate:"required"`
+	App              AppConfig              `mapstructure:"app" validate:"required"`
+	Database         DatabaseConfig         `mapstructure:"database" validate:"required"`
+	Redis            RedisConfig            `mapstructure:"redis" validate:"required"`
+	Secrete          SecretConfig           `mapstructure:"secrete" validate:"required"`
+	ProductService   ProductService         `mapstructure:"product_service" validate:"required"`
+	Kafka            KafkaConfig            `mapstructure:"kafka" validate:"required"`
+	Outbox           OutboxConfig           `mapstructure:"outbox" validate:"required"`
+	StockReservation StockReservationConfig `mapstructure:"stock_reservation" validate:"required"`
+	CheckoutSaga     CheckoutSagaConfig     `mapstructure:"checkout_saga" validate:"required"`
+	Idempotency      IdempotencyConfig      `mapstructure:"idempotency" validate:"required"`
+	Currency         CurrencyConfig         `mapstructure:"currency" validate:"required"`
+	Pricing          PricingConfig          `mapstructure:"pricing" validate:"required"`
+	Address          AddressConfig          `mapstructure:"address"`
+	PaymentMethods   []PaymentMethodConfig  `mapstructure:"payment_methods" validate:"required"`
+	Cancellation     CancellationConfig     `mapstructure:"order_cancellation" validate:"required"`
 }
 
 type ProductService struct {
-	Host string `mapstructure:"host" validate:"required"`
+	Host                    string        `mapstructure:"host" validate:"required"`
+	Concurrency             int           `mapstructure:"concurrency" validate:"required"`
+	CacheTTL                time.Duration `mapstructure:"cache_ttl" validate:"required"`
+	Timeout                 time.Duration `mapstructure:"timeout" validate:"required"`
+	MaxRetries              int           `mapstructure:"max_retries"`
+	RetryBackoff            time.Duration `mapstructure:"retry_backoff" validate:"required"`
+	BreakerFailureThreshold int           `mapstructure:"breaker_failure_threshold" validate:"required"`
+	BreakerOpenTimeout      time.Duration `mapstructure:"breaker_open_timeout" validate:"required"`
+}
+
+type KafkaConfig struct {
+	Brokers  []string            `mapstructure:"brokers" validate:"required"`
+	Consumer KafkaConsumerConfig `mapstructure:"consumer" validate:"required"`
+}
+
+type KafkaConsumerConfig struct {
+	GroupID             string        `mapstructure:"group_id" validate:"required"`
+	PaymentSuccessTopic string        `mapstructure:"payment_success_topic" validate:"required"`
+	PaymentFailedTopic  string        `mapstructure:"payment_failed_topic" validate:"required"`
+	RefundSuccessTopic  string        `mapstructure:"refund_success_topic" validate:"required"`
+	RefundFailedTopic   string        `mapstructure:"refund_failed_topic" validate:"required"`
+	RetryBackoff        time.Duration `mapstructure:"retry_backoff" validate:"required"`
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration `mapstructure:"poll_interval" validate:"required"`
+	BatchSize    int           `mapstructure:"batch_size" validate:"required"`
+	BaseBackoff  time.Duration `mapstructure:"base_backoff" validate:"required"`
+	MaxBackoff   time.Duration `mapstructure:"max_backoff" validate:"required"`
+	ClaimTTL     time.Duration `mapstructure:"claim_ttl" validate:"required"` // how long a claimed event waits before another relay retries it
+}
+
+type StockReservationConfig struct {
+	TTL           time.Duration `mapstructure:"ttl" validate:"required"`
+	SweepInterval time.Duration `mapstructure:"sweep_interval" validate:"required"`
+	SweepBatch    int           `mapstructure:"sweep_batch" validate:"required"`
+}
+
+type CheckoutSagaConfig struct {
+	RecoverInterval time.Duration `mapstructure:"recover_interval" validate:"required"`
+	StaleAfter      time.Duration `mapstructure:"stale_after" validate:"required"`
+	RecoverBatch    int           `mapstructure:"recover_batch" validate:"required"`
+}
+
+// IdempotencyConfig hold how long Idempotency-Key responses (Retention) and checkout request logs
+// (RequestLogRetention) are replayed. LockTTL is how long a running request may go without a
+// heartbeat before a retry takes its key over.
+type IdempotencyConfig struct {
+	Retention           time.Duration `mapstructure:"retention" validate:"required"`
+	RequestLogRetention time.Duration `mapstructure:"request_log_retention" validate:"required"`
+	LockTTL             time.Duration `mapstructure:"lock_ttl" validate:"required"`
+	PurgeInterval       time.Duration `mapstructure:"purge_interval" validate:"required"`
+	PurgeBatch          int           `mapstructure:"purge_batch" validate:"required"`
+}
+
+type CurrencyConfig struct {
+	Base      string `mapstructure:"base" validate:"required"` // currency of the product catalog
+	RatesFile string `mapstructure:"rates_file" validate:"required"`
+}
+
+// PricingConfig hold the shipping and tax tables. Fees are decimal strings in the catalog currency,
+// tax rates are percentages. Regions are ISO 3166 codes, "ID-JK" falls back to "ID" when not listed.
+type PricingConfig struct {
+	DefaultRegion string         `mapstructure:"default_region" validate:"required"`
+	Shipping      ShippingConfig `mapstructure:"shipping" validate:"required"`
+	Tax           TaxConfig      `mapstructure:"tax" validate:"required"`
+}
+
+type ShippingConfig struct {
+	DefaultZone string               `mapstructure:"default_zone" validate:"required"`
+	Zones       []ShippingZoneConfig `mapstructure:"zones" validate:"required"`
+}
+
+type ShippingZoneConfig struct {
+	Name     string   `mapstructure:"name" validate:"required"`
+	Regions  []string `mapstructure:"regions"`
+	BaseFee  string   `mapstructure:"base_fee" validate:"required"`
+	PerKgFee string   `mapstructure:"per_kg_fee"`
+}
+
+type TaxConfig struct {
+	DefaultRate string          `mapstructure:"default_rate" validate:"required"`
+	Rates       []TaxRateConfig `mapstructure:"rates"`
+}
+
+type TaxRateConfig struct {
+	Region string `mapstructure:"region" validate:"required"`
+	Rate   string `mapstructure:"rate" validate:"required"`
+}
+
+type AddressConfig struct {
+	AllowLegacyString bool `mapstructure:"allow_legacy_string"` // accept the free-form address string of older clients
+}
+
+// PaymentMethodConfig is a payment method accepted at checkout. Amount limits are decimal strings
+// in the catalog currency, an empty currency list allows every currency.
+type PaymentMethodConfig struct {
+	Code       string   `mapstructure:"code" validate:"required"`
+	Name       string   `mapstructure:"name" validate:"required"`
+	Enabled    bool     `mapstructure:"enabled"`
+	Currencies []string `mapstructure:"currencies"`
+	MinAmount  string   `mapstructure:"min_amount"`
+	MaxAmount  string   `mapstructure:"max_amount"`
+}
+
+type CancellationConfig struct {
+	Window time.Duration `mapstructure:"window" validate:"required"` // how long after checkout a customer can cancel
 }
 
 type AppConfig struct {
-	Port string `mapstructure:"port" validate:"required"`
+	Port            string        `mapstructure:"port" validate:"required"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout" validate:"required"`
 }
 
 type DatabaseConfig struct {
-	Host     string `mapstructure:"host" validate:"required"`
-	Port     string `mapstructure:"port" validate:"required"`
-	Name     string `mapstructure:"name" validate:"required"`
-	Password string `mapstructure:"password" validate:"required"`
-	User     string `mapstructure:"user" validate:"required"`
+	Host      string          `mapstructure:"host" validate:"required"`
+	Port      string          `mapstructure:"port" validate:"required"`
+	Name      string          `mapstructure:"name" validate:"required"`
+	Password  string          `mapstructure:"password" validate:"required"`
+	User      string          `mapstructure:"user" validate:"required"`
+	Migration MigrationConfig `mapstructure:"migration"`
+}
+
+type MigrationConfig struct {
+	RequireLatest  bool          `mapstructure:"require_latest"`
+	LockTimeout    time.Duration `mapstructure:"lock_timeout"`
+	StaleLockAfter time.Duration `mapstructure:"stale_lock_after"`
 }
 
 type RedisConfig struct {
@@ -0,0 +1,32 @@
+package constant
+
+import "errors"
+
+var (
+	ErrOrderNotFound           = errors.New("order not found")
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+	ErrInvalidStatusRequest    = errors.New("invalid order status request")
+	ErrInsufficientStock       = errors.New("insufficient product stock")
+	ErrSagaNotFound            = errors.New("checkout saga not found")
+	ErrIdempotencyKeyReused    = errors.New("idempotency token was already used with a different request")
+	ErrRequestInProgress       = errors.New("a request with the same idempotency token is in progress")
+	ErrDuplicateIdempotency    = errors.New("idempotency token already saved")
+	ErrUnsupportedCurrency     = errors.New("unsupported currency")
+	ErrCouponNotFound          = errors.New("coupon not found")
+	ErrCouponNotApplicable     = errors.New("coupon cannot be applied to this order")
+	ErrCouponUsageExceeded     = errors.New("coupon usage limit reached")
+	ErrInvalidAddress          = errors.New("invalid shipping address")
+	ErrAddressNotFound         = errors.New("address not found")
+	ErrAddressBookFull         = errors.New("address book is full")
+	ErrAddressConflict         = errors.New("address book was changed by another request")
+	ErrUnsupportedPayment      = errors.New("unsupported payment method")
+	ErrPaymentNotAllowed       = errors.New("payment method is not allowed for this order")
+	ErrCancellationWindow      = errors.New("order can no longer be cancelled")
+	ErrStatusUnchanged         = errors.New("order already has the requested status")
+	ErrInvalidItemCancel       = errors.New("invalid order item cancellation")
+	ErrReturnNotFound          = errors.New("return not found")
+	ErrInvalidReturn           = errors.New("invalid return request")
+	ErrInvalidReturnStatus     = errors.New("invalid return status transition")
+	ErrRefundNotFound          = errors.New("refund not found")
+	ErrInvalidRefundRetry      = errors.New("refund cannot be retried")
+)
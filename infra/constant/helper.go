@@ -1,5 +1,8 @@
 package constant
 
+// RoleAdmin is the role claim of the tokens allowed on the admin endpoints
+const RoleAdmin = "admin"
+
 const (
 	OrderStatusCreated    = 0
 	OrderStatusProcessing = 1
@@ -15,3 +18,146 @@ var OrderStatusTranslated = map[int]string{
 	OrderStatusCancelled:  "cancelled",
 	OrderStatusFailed:     "failed",
 }
+
+// OrderStatusAll is the status filter value that matches every order
+const OrderStatusAll = "all"
+
+// OrderStatusNames list the status names in status order
+var OrderStatusNames = []string{
+	OrderStatusTranslated[OrderStatusCreated],
+	OrderStatusTranslated[OrderStatusProcessing],
+	OrderStatusTranslated[OrderStatusCompleted],
+	OrderStatusTranslated[OrderStatusCancelled],
+	OrderStatusTranslated[OrderStatusFailed],
+}
+
+// ParseOrderStatus get the status value of a status name from OrderStatusTranslated
+func ParseOrderStatus(name string) (int, bool) {
+	for status, translated := range OrderStatusTranslated {
+		if translated == name {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+const (
+	OrderItemStatusActive             = 0
+	OrderItemStatusPartiallyCancelled = 1
+	OrderItemStatusCancelled          = 2
+	OrderItemStatusFulfilled          = 3
+	OrderItemStatusRefunded           = 4
+)
+
+var OrderItemStatusTranslated = map[int]string{
+	OrderItemStatusActive:             "active",
+	OrderItemStatusPartiallyCancelled: "partially_cancelled",
+	OrderItemStatusCancelled:          "cancelled",
+	OrderItemStatusFulfilled:          "fulfilled",
+	OrderItemStatusRefunded:           "refunded",
+}
+
+const (
+	ReturnStatusRequested = 0
+	ReturnStatusApproved  = 1
+	ReturnStatusRejected  = 2
+	ReturnStatusReceived  = 3
+)
+
+var ReturnStatusTranslated = map[int]string{
+	ReturnStatusRequested: "requested",
+	ReturnStatusApproved:  "approved",
+	ReturnStatusRejected:  "rejected",
+	ReturnStatusReceived:  "received",
+}
+
+const (
+	RefundStatusPending   = 0
+	RefundStatusCompleted = 1
+	RefundStatusFailed    = 2
+)
+
+var RefundStatusTranslated = map[int]string{
+	RefundStatusPending:   "pending",
+	RefundStatusCompleted: "completed",
+	RefundStatusFailed:    "failed",
+}
+
+const (
+	OrderHistoryDefaultLimit = 20
+	OrderHistoryMaxLimit     = 100
+)
+
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+const (
+	StockReservationStatusReserved  = 0
+	StockReservationStatusConfirmed = 1
+	StockReservationStatusReleased  = 2
+)
+
+const (
+	StockItemReleaseStatusPending  = 0
+	StockItemReleaseStatusReleased = 1
+)
+
+const (
+	SagaStatusRunning         = 0
+	SagaStatusAwaitingPayment = 1
+	SagaStatusCompleted       = 2
+	SagaStatusCompensating    = 3
+	SagaStatusCompensated     = 4
+)
+
+var SagaStatusTranslated = map[int]string{
+	SagaStatusRunning:         "running",
+	SagaStatusAwaitingPayment: "awaiting_payment",
+	SagaStatusCompleted:       "completed",
+	SagaStatusCompensating:    "compensating",
+	SagaStatusCompensated:     "compensated",
+}
+
+const (
+	IdempotencyStatusInProgress = 0
+	IdempotencyStatusCompleted  = 1
+)
+
+const (
+	OutboxStatusPending = 0
+	OutboxStatusSent    = 1
+)
+
+const (
+	TopicOrderCreated   = "order.created"
+	TopicOrderCancelled = "order.cancelled"
+	TopicItemsCancelled = "order.items_cancelled"
+	TopicRefundRequest  = "order.refund_requested"
+	TopicPaymentRequest = "order.payment_requested"
+	TopicPaymentCancel  = "order.payment_cancelled"
+)
+
+const (
+	CouponTypePercentage   = 1
+	CouponTypeFixedAmount  = 2
+	CouponTypeBuyXGetY     = 3
+	CouponTypeFreeShipping = 4
+)
+
+var CouponTypeTranslated = map[int]string{
+	CouponTypePercentage:   "percentage",
+	CouponTypeFixedAmount:  "fixed_amount",
+	CouponTypeBuyXGetY:     "buy_x_get_y",
+	CouponTypeFreeShipping: "free_shipping",
+}
+
+// MaxCouponsPerOrder bound how many coupon codes a checkout can carry
+const MaxCouponsPerOrder = 5
+
+// MaxAddressesPerUser bound the size of a user's address book
+const MaxAddressesPerUser = 20
+
+// MaxAddressLabelLength bound the label of a saved address, e.g. "home"
+const MaxAddressLabelLength = 50
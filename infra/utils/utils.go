@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
 	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
 )
 
 func GetUserID(c *gin.Context) (float64, error) {
@@ -16,3 +20,49 @@ func GetUserID(c *gin.Context) (float64, error) {
 	}
 	return id, nil
 }
+
+// EncodeCursor turn the id of the last returned row into an opaque pagination cursor
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// DecodeCursor read the id back from a cursor produced by EncodeCursor
+func DecodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return id, nil
+}
+
+// Heartbeat call refresh every interval until the returned stop is called, it keeps a lock alive
+// while the work holding it runs. stop waits for a refresh in flight to return.
+func Heartbeat(ctx context.Context, interval time.Duration, refresh func(ctx context.Context)) (stop func()) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refresh(ctx)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-stopped
+	}
+}
@@ -0,0 +1,93 @@
+package kafka
+
+import (
+	"context"
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"order_service/infra/log"
+	"time"
+)
+
+// MessageHandler process a single message. Returning an error makes the consumer retry the same message.
+type MessageHandler func(ctx context.Context, msg kafka.Message) error
+
+type KafkaConsumer struct {
+	reader       *kafka.Reader
+	handler      MessageHandler
+	retryBackoff time.Duration
+}
+
+func NewKafkaConsumer(brokers []string, groupID string, topics []string, handler MessageHandler, retryBackoff time.Duration) *KafkaConsumer {
+	// offsets are committed explicitly, and only after the handler succeeded
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		GroupID:     groupID,
+		GroupTopics: topics,
+	})
+
+	return &KafkaConsumer{
+		reader:       reader,
+		handler:      handler,
+		retryBackoff: retryBackoff,
+	}
+}
+
+func (k *KafkaConsumer) Close() error {
+	return k.reader.Close()
+}
+
+// Run fetch and handle messages until ctx is cancelled
+func (k *KafkaConsumer) Run(ctx context.Context) {
+	log.Logger.Info("kafka consumer started")
+	for {
+		msg, err := k.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Logger.Info("kafka consumer stopped")
+				return
+			}
+
+			log.Logger.WithFields(logrus.Fields{
+				"err": err.Error(),
+			}).Error("failed to fetch message")
+			continue
+		}
+
+		if !k.handle(ctx, msg) {
+			log.Logger.Info("kafka consumer stopped")
+			return
+		}
+
+		if err = k.reader.CommitMessages(ctx, msg); err != nil {
+			log.Logger.WithFields(logrus.Fields{
+				"topic":     msg.Topic,
+				"partition": msg.Partition,
+				"offset":    msg.Offset,
+				"err":       err.Error(),
+			}).Error("failed to commit message")
+		}
+	}
+}
+
+// handle retry the handler until it succeeds, it returns false when ctx is cancelled first
+func (k *KafkaConsumer) handle(ctx context.Context, msg kafka.Message) bool {
+	for {
+		err := k.handler(ctx, msg)
+		if err == nil {
+			return true
+		}
+
+		log.Logger.WithFields(logrus.Fields{
+			"topic":     msg.Topic,
+			"partition": msg.Partition,
+			"offset":    msg.Offset,
+			"err":       err.Error(),
+		}).Error("failed to handle message, retrying")
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(k.retryBackoff):
+		}
+	}
+}
@@ -2,23 +2,23 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"github.com/segmentio/kafka-go"
 	"github.com/sirupsen/logrus"
 	"order_service/infra/log"
-	"order_service/models"
+	"time"
 )
 
 type KafkaProducer struct {
 	writer *kafka.Writer
 }
 
-func NewKafkaProducer(brokers []string, topic string) *KafkaProducer {
+func NewKafkaProducer(brokers []string) *KafkaProducer {
+	// the topic is set per message so a single writer can serve every event published by the outbox relay
 	writer := &kafka.Writer{
-		Topic:    topic,
-		Addr:     kafka.TCP(brokers...),
-		Balancer: &kafka.LeastBytes{},
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.LeastBytes{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
 	}
 
 	return &KafkaProducer{
@@ -30,19 +30,22 @@ func (k *KafkaProducer) Close() error {
 	return k.writer.Close()
 }
 
-func (k *KafkaProducer) PublishOrderCreated(ctx context.Context, event interface{}) error {
-	value, err := json.Marshal(event)
+// Publish write a single message to the given topic and wait until the brokers acknowledge it
+func (k *KafkaProducer) Publish(ctx context.Context, topic string, key string, value []byte) error {
+	msg := kafka.Message{
+		Topic: topic,
+		Key:   []byte(key),
+		Value: value,
+	}
+
+	err := k.writer.WriteMessages(ctx, msg)
 	if err != nil {
 		log.Logger.WithFields(logrus.Fields{
 			"err":   err.Error(),
-			"event": event,
-		})
+			"topic": topic,
+			"key":   key,
+		}).Error("failed to publish message")
 		return err
 	}
-
-	msg := kafka.Message{
-		Key:   []byte(fmt.Sprintf("order-%d", event.(models.OrderCreatedEvent).OrderID)),
-		Value: value,
-	}
-	return k.writer.WriteMessages(ctx, msg)
+	return nil
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"order_service/infra/log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type shutdownStep struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Lifecycle run the http server and the background workers until SIGTERM or SIGINT, then stop
+// them in order: drain the in-flight requests, stop the workers, and run the shutdown steps in
+// the order they were registered. Everything up to the last step shares ShutdownTimeout, steps
+// left when it runs out, or while requests or workers still run, are skipped and logged.
+type Lifecycle struct {
+	ShutdownTimeout time.Duration
+
+	workerCtx   context.Context
+	stopWorkers context.CancelFunc
+	workers     sync.WaitGroup
+	steps       []shutdownStep
+}
+
+func NewLifecycle(shutdownTimeout time.Duration) *Lifecycle {
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	return &Lifecycle{
+		ShutdownTimeout: shutdownTimeout,
+		workerCtx:       workerCtx,
+		stopWorkers:     stopWorkers,
+	}
+}
+
+// Go run a background worker until shutdown, run must return once its ctx is cancelled
+func (l *Lifecycle) Go(name string, run func(ctx context.Context)) {
+	l.workers.Add(1)
+	go func() {
+		defer l.workers.Done()
+		run(l.workerCtx)
+		log.Logger.WithFields(logrus.Fields{
+			"worker": name,
+		}).Info("worker exited")
+	}()
+}
+
+// OnShutdown register a step to run after the server and the workers stopped. Steps run in
+// registration order, so resources must be registered after the ones that still use them.
+func (l *Lifecycle) OnShutdown(name string, run func(ctx context.Context) error) {
+	l.steps = append(l.steps, shutdownStep{name: name, run: run})
+}
+
+// Serve run server until a signal arrives or it fails, then shut everything down. It returns the
+// server error, if any, once the shutdown is done.
+func (l *Lifecycle) Serve(server *http.Server) error {
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stopSignals()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Logger.WithFields(logrus.Fields{
+			"addr": server.Addr,
+		}).Info("server running")
+		serverErr <- server.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case <-signalCtx.Done():
+		log.Logger.Info("shutdown signal received")
+	case err = <-serverErr:
+		log.Logger.WithFields(logrus.Fields{
+			"err": err.Error(),
+		}).Error("server stopped unexpectedly")
+	}
+
+	l.shutdown(server)
+	return err
+}
+
+func (l *Lifecycle) shutdown(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.ShutdownTimeout)
+	defer cancel()
+
+	// the steps close what requests and workers use, they are skipped while any of them still runs
+	var busy string
+
+	log.Logger.Info("draining http requests")
+	if err := server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Logger.WithFields(logrus.Fields{
+			"err": err.Error(),
+		}).Warn("http requests not drained before the deadline")
+		busy = "http requests still running"
+	}
+
+	log.Logger.Info("stopping workers")
+	l.stopWorkers()
+	stopped := make(chan struct{})
+	go func() {
+		l.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Logger.Warn("workers not stopped before the deadline")
+		busy = "workers still running"
+	}
+
+	for _, step := range l.steps {
+		reason := busy
+		if reason == "" && ctx.Err() != nil {
+			reason = "shutdown deadline passed"
+		}
+
+		if reason != "" {
+			log.Logger.WithFields(logrus.Fields{
+				"step":   step.name,
+				"reason": reason,
+			}).Warn("shutdown step skipped")
+			continue
+		}
+
+		log.Logger.WithFields(logrus.Fields{
+			"step": step.name,
+		}).Info("shutting down")
+
+		if err := step.run(ctx); err != nil {
+			log.Logger.WithFields(logrus.Fields{
+				"step": step.name,
+				"err":  err.Error(),
+			}).Error("shutdown step failed")
+		}
+	}
+	log.Logger.Info("shutdown complete")
+}
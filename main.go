@@ -1,17 +1,22 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"github.com/gin-gonic/gin"
+	"net/http"
 	"order_service/cmd/handler"
 	"order_service/cmd/repository"
 	"order_service/cmd/resource"
 	"order_service/cmd/service"
 	"order_service/cmd/usecase"
+	"order_service/cmd/worker"
 	"order_service/config"
 	"order_service/infra/log"
 	"order_service/kafka"
+	"order_service/migrations"
+	"order_service/product"
 	"order_service/routes"
+	"os"
 )
 
 func main() {
@@ -22,18 +27,95 @@ func main() {
 	)
 	log.SetupLogger()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg, os.Args[2:])
+		return
+	}
+
 	db := resource.InitDB(&cfg)
+	migrator, err := migrations.NewMigrator(db, cfg.Database.Migration)
+	if err != nil {
+		log.Logger.Fatalf("failed to load migrations: %s", err)
+	}
+	checkSchema(cfg, migrator)
+
 	redis := resource.InitRedis(&cfg)
-	kafkaProducer := kafka.NewKafkaProducer([]string{"localhost:9093"}, "order.created")
+	kafkaProducer := kafka.NewKafkaProducer(cfg.Kafka.Brokers)
+
+	productClient := product.NewClient(cfg.ProductService)
 
-	orderRepo := repository.NewOrderRepository(db, redis, cfg.ProductService.Host)
+	orderRepo := repository.NewOrderRepository(db, redis, productClient, cfg.ProductService)
 	orderService := service.NewOrderService(*orderRepo)
-	orderUseCase := usecase.NewOrderUseCase(*orderService, *kafkaProducer)
+	stockReserver := repository.NewProductStockReserver(productClient)
+	rateProvider, err := repository.NewFileRateProvider(cfg.Currency)
+	if err != nil {
+		log.Logger.Fatalf("failed to load exchange rates: %s", err)
+	}
+	pricingPipeline, err := usecase.NewPricingPipeline(cfg.Pricing)
+	if err != nil {
+		log.Logger.Fatalf("invalid pricing config: %s", err)
+	}
+	paymentMethods, err := usecase.NewPaymentMethodRegistry(cfg.PaymentMethods)
+	if err != nil {
+		log.Logger.Fatalf("invalid payment methods config: %s", err)
+	}
+	orderUseCase := usecase.NewOrderUseCase(*orderService, stockReserver, rateProvider, pricingPipeline, paymentMethods, cfg.StockReservation, cfg.Currency, cfg.Address, cfg.Cancellation, cfg.Idempotency)
 	orderHandler := handler.NewHandler(*orderUseCase)
 
+	lifecycle := NewLifecycle(cfg.App.ShutdownTimeout)
+
+	outboxRelay := worker.NewOutboxRelay(*orderService, *kafkaProducer, cfg.Outbox)
+	lifecycle.Go("outbox relay", outboxRelay.Run)
+
+	reservationSweeper := worker.NewReservationSweeper(*orderUseCase, cfg.StockReservation)
+	lifecycle.Go("reservation sweeper", reservationSweeper.Run)
+
+	sagaRecoverer := worker.NewSagaRecoverer(*orderUseCase, cfg.CheckoutSaga)
+	lifecycle.Go("saga recoverer", sagaRecoverer.Run)
+
+	idempotencyPurger := worker.NewIdempotencyPurger(*orderService, cfg.Idempotency)
+	lifecycle.Go("idempotency purger", idempotencyPurger.Run)
+
+	paymentHandler := handler.NewPaymentEventHandler(*orderUseCase, cfg.Kafka.Consumer)
+	paymentConsumer := kafka.NewKafkaConsumer(
+		cfg.Kafka.Brokers,
+		cfg.Kafka.Consumer.GroupID,
+		paymentHandler.Topics(),
+		paymentHandler.HandleMessage,
+		cfg.Kafka.Consumer.RetryBackoff,
+	)
+	lifecycle.Go("payment consumer", paymentConsumer.Run)
+
+	// resources are closed after everything that uses them: the outbox flush still needs kafka and the db
+	lifecycle.OnShutdown("flush outbox", func(ctx context.Context) error {
+		outboxRelay.Flush(ctx)
+		return nil
+	})
+	lifecycle.OnShutdown("close kafka consumer", func(ctx context.Context) error {
+		return paymentConsumer.Close()
+	})
+	lifecycle.OnShutdown("close kafka producer", func(ctx context.Context) error {
+		return kafkaProducer.Close()
+	})
+	lifecycle.OnShutdown("close redis", func(ctx context.Context) error {
+		return redis.Close()
+	})
+	lifecycle.OnShutdown("close database", func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Close()
+	})
+
 	router := gin.Default()
-	routes.SetupRoutes(router, *orderHandler, cfg.Secrete.JWTSecret)
+	routes.SetupRoutes(router, *orderHandler, cfg.Secrete.JWTSecret, orderService, cfg.Idempotency)
 
-	_ = router.Run(":" + cfg.App.Port)
-	fmt.Println("Server running on port:", cfg.App.Port)
+	server := &http.Server{
+		Addr:    ":" + cfg.App.Port,
+		Handler: router,
+	}
+	if err = lifecycle.Serve(server); err != nil {
+		log.Logger.Fatalf("server failed: %s", err)
+	}
 }
@@ -69,6 +69,26 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		}
 
 		c.Set("user_id", uid)
+
+		// the role claim is optional, tokens without one belong to customers
+		if role, ok := claims["role"].(string); ok {
+			c.Set("role", role)
+		}
+		c.Next()
+	}
+}
+
+// RequireRole only let through requests whose token carries the given role claim
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != role {
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "forbidden",
+				"error":   "the token lacks the " + role + " role",
+			})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"order_service/infra/constant"
+	"order_service/infra/log"
+	"order_service/infra/utils"
+	"order_service/models"
+	"time"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLength = 255
+
+type IdempotencyStore interface {
+	BeginIdempotentRequest(ctx context.Context, record *models.IdempotencyKey) (*models.IdempotencyKey, error)
+	CompleteIdempotentRequest(ctx context.Context, id int64, responseStatus int, responseBody string) error
+	AbortIdempotentRequest(ctx context.Context, id int64) error
+	RefreshIdempotentRequest(ctx context.Context, id int64, lockExpireTime time.Time) error
+}
+
+// responseRecorder keep a copy of the response body so it can be stored for replays
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// IdempotencyMiddleware make mutating requests carrying an Idempotency-Key header idempotent.
+// Keys are scoped per user_id and kept for retention. A retry with the same key and body replays
+// the stored response, a reused key with a different body gets a 422, and a retry while the first
+// request is still running gets a 409. The running request refreshes its lock so only a request
+// that died, silent for lockTTL, is taken over. Server errors free the key so the request can be retried.
+func IdempotencyMiddleware(store IdempotencyStore, retention time.Duration, lockTTL time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !isMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "idempotency key is too long",
+			})
+			c.Abort()
+			return
+		}
+
+		userId, err := utils.GetUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"message": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid request",
+			})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		record := &models.IdempotencyKey{
+			UserID:         int64(userId),
+			IdempotencyKey: key,
+			Method:         c.Request.Method,
+			Path:           c.Request.URL.Path,
+			RequestHash:    requestHash(c.Request.Method, c.Request.URL.Path, body),
+			Status:         constant.IdempotencyStatusInProgress,
+			CreateTime:     now,
+			ExpireTime:     now.Add(retention),
+			LockExpireTime: now.Add(lockTTL),
+		}
+
+		existing, err := store.BeginIdempotentRequest(c.Request.Context(), record)
+		if err != nil {
+			log.Logger.WithFields(logrus.Fields{
+				"idempotency_key": key,
+				"err":             err.Error(),
+			}).Error("failed to register idempotency key")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "failed to register idempotency key",
+			})
+			c.Abort()
+			return
+		}
+
+		if existing != nil {
+			replayIdempotentResponse(c, existing, record.RequestHash)
+			return
+		}
+
+		stop := utils.Heartbeat(c.Request.Context(), lockTTL/3, func(ctx context.Context) {
+			if err := store.RefreshIdempotentRequest(ctx, record.ID, time.Now().Add(lockTTL)); err != nil {
+				log.Logger.WithFields(logrus.Fields{
+					"idempotency_key": key,
+					"err":             err.Error(),
+				}).Warn("failed to refresh idempotency key lock")
+			}
+		})
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		stop()
+
+		ctx := context.WithoutCancel(c.Request.Context())
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			err = store.AbortIdempotentRequest(ctx, record.ID)
+		} else {
+			err = store.CompleteIdempotentRequest(ctx, record.ID, status, recorder.body.String())
+		}
+
+		if err != nil {
+			log.Logger.WithFields(logrus.Fields{
+				"idempotency_key": key,
+				"err":             err.Error(),
+			}).Error("failed to store idempotent response")
+		}
+	}
+}
+
+// RequireIdempotencyKey reject requests without an Idempotency-Key header, for routes that are not
+// safe to run twice such as cancelling part of an order
+func RequireIdempotencyKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(IdempotencyKeyHeader) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": IdempotencyKeyHeader + " header is required",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func replayIdempotentResponse(c *gin.Context, existing *models.IdempotencyKey, requestHash string) {
+	switch {
+	case existing.RequestHash != requestHash:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"message": "idempotency key was already used with a different request",
+		})
+	case existing.Status == constant.IdempotencyStatusInProgress:
+		c.JSON(http.StatusConflict, gin.H{
+			"message": "a request with the same idempotency key is in progress",
+		})
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(existing.ResponseStatus, "application/json; charset=utf-8", []byte(existing.ResponseBody))
+	}
+	c.Abort()
+}
+
+func requestHash(method string, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
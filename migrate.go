@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"order_service/cmd/resource"
+	"order_service/config"
+	"order_service/infra/log"
+	"order_service/migrations"
+	"strconv"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status | baseline <version>"
+
+// runMigrate run the migrate subcommand against the configured database
+func runMigrate(cfg config.Config, args []string) {
+	if len(args) == 0 {
+		log.Logger.Fatal(migrateUsage)
+	}
+
+	db := resource.InitDB(&cfg)
+	migrator, err := migrations.NewMigrator(db, cfg.Database.Migration)
+	if err != nil {
+		log.Logger.Fatalf("failed to load migrations: %s", err)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Logger.Fatalf("failed to migrate up: %s", err)
+		}
+		fmt.Printf("applied %d migration(s)\n", len(applied))
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Logger.Fatal(migrateUsage)
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Logger.Fatalf("failed to migrate down: %s", err)
+		}
+		fmt.Printf("reverted %d migration(s)\n", len(reverted))
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Logger.Fatalf("failed to get migration status: %s", err)
+		}
+
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedTime.Format("2006-01-02 15:04:05")
+			}
+			if status.Unknown {
+				state += " (unknown to this binary)"
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+
+	case "baseline":
+		if len(args) < 2 {
+			log.Logger.Fatal(migrateUsage)
+		}
+
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			log.Logger.Fatal(migrateUsage)
+		}
+
+		if err = migrator.Baseline(ctx, version); err != nil {
+			log.Logger.Fatalf("failed to baseline migrations: %s", err)
+		}
+		fmt.Printf("marked migrations up to %d as applied\n", version)
+
+	default:
+		log.Logger.Fatal(migrateUsage)
+	}
+}
+
+// checkSchema refuse to start when the database is missing migrations of this binary
+func checkSchema(cfg config.Config, migrator *migrations.Migrator) {
+	if !cfg.Database.Migration.RequireLatest {
+		return
+	}
+
+	if err := migrator.CheckCurrent(context.Background()); err != nil {
+		log.Logger.Fatalf("%s, run `migrate up` first", err)
+	}
+}
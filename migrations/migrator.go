@@ -0,0 +1,384 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"order_service/config"
+	"order_service/infra/log"
+	"os"
+	"time"
+)
+
+var (
+	ErrOutdatedSchema = errors.New("database schema is outdated")
+	ErrLocked         = errors.New("migration lock is held by another process")
+	ErrUnknownVersion = errors.New("applied migration is unknown to this binary")
+	ErrLockLost       = errors.New("migration lock was lost")
+)
+
+const (
+	defaultLockTimeout    = time.Minute
+	defaultStaleLockAfter = 15 * time.Minute
+	lockRetryInterval     = time.Second
+	minHeartbeatInterval  = time.Second
+)
+
+// bootstrapSQL create the version table and the single row lock table used by every migrator
+const bootstrapSQL = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version      BIGINT PRIMARY KEY,
+    name         TEXT NOT NULL,
+    applied_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS schema_migration_lock (
+    id        INTEGER PRIMARY KEY CHECK (id = 1),
+    owner     TEXT NOT NULL DEFAULT '',
+    lock_time TIMESTAMP
+);
+
+INSERT INTO schema_migration_lock (id) VALUES (1) ON CONFLICT (id) DO NOTHING;
+`
+
+// MigrationStatus is a migration and whether it is applied. Versions applied in the database but
+// missing from this binary are listed with Unknown set.
+type MigrationStatus struct {
+	Version     int64
+	Name        string
+	Applied     bool
+	AppliedTime *time.Time
+	Unknown     bool
+}
+
+type appliedMigration struct {
+	Version     int64
+	Name        string
+	AppliedTime time.Time
+}
+
+// Migrator apply the embedded migrations. Changing commands hold the schema_migration_lock row so
+// replicas started together don't migrate at the same time.
+type Migrator struct {
+	Database   *gorm.DB
+	Migrations []Migration
+	Config     config.MigrationConfig
+	Owner      string
+}
+
+func NewMigrator(db *gorm.DB, cfg config.MigrationConfig) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.LockTimeout <= 0 {
+		cfg.LockTimeout = defaultLockTimeout
+	}
+	if cfg.StaleLockAfter <= 0 {
+		cfg.StaleLockAfter = defaultStaleLockAfter
+	}
+
+	hostname, _ := os.Hostname()
+	return &Migrator{
+		Database:   db,
+		Migrations: migrations,
+		Config:     cfg,
+		Owner:      fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), uuid.New().String()),
+	}, nil
+}
+
+// Up apply every pending migration, oldest first, and return the applied ones. Each migration runs
+// in its own transaction with its version row, so a failure keeps the migrations before it.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		pending, err := m.pending(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range pending {
+			err = m.Database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return err
+				}
+				return tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+
+			log.Logger.WithFields(logrus.Fields{
+				"version": migration.Version,
+				"name":    migration.Name,
+			}).Info("migration applied")
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down revert the last steps applied migrations, newest first, and return the reverted ones
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		known := m.byVersion()
+		for i := len(applied) - 1; i >= 0 && len(done) < steps; i-- {
+			migration, ok := known[applied[i].Version]
+			if !ok {
+				return fmt.Errorf("%w: %d_%s", ErrUnknownVersion, applied[i].Version, applied[i].Name)
+			}
+
+			err = m.Database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return err
+				}
+				return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+
+			log.Logger.WithFields(logrus.Fields{
+				"version": migration.Version,
+				"name":    migration.Name,
+			}).Info("migration reverted")
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Baseline mark every migration up to version as applied without running it, for a database whose
+// schema was created by hand before migrations were versioned
+func (m *Migrator) Baseline(ctx context.Context, version int64) error {
+	if _, ok := m.byVersion()[version]; !ok {
+		return fmt.Errorf("migration %d does not exist", version)
+	}
+
+	return m.withLock(ctx, func(ctx context.Context) error {
+		for _, migration := range m.Migrations {
+			if migration.Version > version {
+				break
+			}
+
+			err := m.Database.WithContext(ctx).
+				Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?) ON CONFLICT (version) DO NOTHING", migration.Version, migration.Name).
+				Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status list the migrations of this binary and the applied versions it doesn't know, by version
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	appliedOf := make(map[int64]appliedMigration, len(applied))
+	for _, migration := range applied {
+		appliedOf[migration.Version] = migration
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.Migrations))
+	known := m.byVersion()
+	for _, migration := range m.Migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := appliedOf[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedTime = &row.AppliedTime
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, row := range applied {
+		if _, ok := known[row.Version]; !ok {
+			statuses = append(statuses, MigrationStatus{
+				Version:     row.Version,
+				Name:        row.Name,
+				Applied:     true,
+				AppliedTime: &row.AppliedTime,
+				Unknown:     true,
+			})
+		}
+	}
+	return statuses, nil
+}
+
+// CheckCurrent return ErrOutdatedSchema when a migration of this binary is not applied yet.
+// Newer versions applied by a later release are fine so a rollback can still boot.
+func (m *Migrator) CheckCurrent(ctx context.Context) error {
+	pending, err := m.pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migration(s), first is %d_%s", ErrOutdatedSchema, len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
+
+// pending get the migrations of this binary that are not applied, oldest first
+func (m *Migrator) pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	isApplied := make(map[int64]bool, len(applied))
+	for _, migration := range applied {
+		isApplied[migration.Version] = true
+	}
+
+	var pending []Migration
+	for _, migration := range m.Migrations {
+		if !isApplied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// applied get the version rows, oldest first. A database never migrated has none.
+func (m *Migrator) applied(ctx context.Context) ([]appliedMigration, error) {
+	var applied []appliedMigration
+	if !m.Database.WithContext(ctx).Migrator().HasTable("schema_migrations") {
+		return applied, nil
+	}
+
+	err := m.Database.WithContext(ctx).Table("schema_migrations").
+		Order("version ASC").
+		Find(&applied).Error
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+func (m *Migrator) byVersion() map[int64]Migration {
+	known := make(map[int64]Migration, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		known[migration.Version] = migration
+	}
+	return known
+}
+
+func (m *Migrator) bootstrap(ctx context.Context) error {
+	return m.Database.WithContext(ctx).Exec(bootstrapSQL).Error
+}
+
+// withLock run fn while holding the migration lock. A lock older than StaleLockAfter is taken
+// over, its owner is assumed to have crashed, so a heartbeat keeps refreshing it while fn runs.
+// If the lock is lost anyway the context of fn is cancelled, rolling back the running migration.
+func (m *Migrator) withLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := m.bootstrap(ctx); err != nil {
+		return err
+	}
+
+	// lock times come from the database clock so replicas with skewed clocks agree on staleness
+	deadline := time.Now().Add(m.Config.LockTimeout)
+	for {
+		result := m.Database.WithContext(ctx).Exec(
+			"UPDATE schema_migration_lock SET owner = ?, lock_time = now() WHERE id = 1 AND (owner = '' OR lock_time < now() - make_interval(secs => ?))",
+			m.Owner, m.Config.StaleLockAfter.Seconds(),
+		)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return ErrLocked
+		}
+
+		log.Logger.Info("waiting for the migration lock")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	defer func() {
+		err := m.Database.WithContext(context.WithoutCancel(ctx)).
+			Exec("UPDATE schema_migration_lock SET owner = '', lock_time = NULL WHERE id = 1 AND owner = ?", m.Owner).
+			Error
+		if err != nil {
+			log.Logger.WithFields(logrus.Fields{
+				"err": err.Error(),
+			}).Warn("failed to release migration lock")
+		}
+	}()
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		m.heartbeat(lockCtx, cancel)
+	}()
+
+	err := fn(lockCtx)
+	cancel(nil)
+	<-stopped
+
+	if cause := context.Cause(lockCtx); errors.Is(cause, ErrLockLost) {
+		if err == nil {
+			return cause
+		}
+		return fmt.Errorf("%w: %w", cause, err)
+	}
+	return err
+}
+
+// heartbeat refresh the lock time until ctx is done. When the lock row no longer belongs to this
+// migrator, another one took it over and lost is called.
+func (m *Migrator) heartbeat(ctx context.Context, lost context.CancelCauseFunc) {
+	interval := max(m.Config.StaleLockAfter/3, minHeartbeatInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result := m.Database.WithContext(ctx).
+			Exec("UPDATE schema_migration_lock SET lock_time = now() WHERE id = 1 AND owner = ?", m.Owner)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case result.Error != nil:
+			// a failed refresh is retried on the next tick, the lock only goes stale after StaleLockAfter
+			log.Logger.WithFields(logrus.Fields{
+				"err": result.Error.Error(),
+			}).Warn("failed to refresh migration lock")
+		case result.RowsAffected == 0:
+			log.Logger.Error("migration lock was taken over by another process")
+			lost(ErrLockLost)
+			return
+		}
+	}
+}
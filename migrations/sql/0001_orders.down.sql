@@ -0,0 +1,3 @@
+DROP TABLE order_request_log;
+DROP TABLE orders;
+DROP TABLE order_detail;
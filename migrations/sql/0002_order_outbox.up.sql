@@ -0,0 +1,15 @@
+CREATE TABLE order_outbox(
+	id BIGSERIAL PRIMARY KEY,
+	aggregate_id BIGINT NOT NULL,
+	topic VARCHAR(255) NOT NULL,
+	message_key TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status INTEGER NOT NULL DEFAULT 0,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	sent_time TIMESTAMP
+);
+
+CREATE INDEX idx_order_outbox_status_id ON order_outbox(status, id);
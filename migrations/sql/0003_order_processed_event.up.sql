@@ -0,0 +1,6 @@
+CREATE TABLE order_processed_event(
+	id BIGSERIAL PRIMARY KEY,
+	event_key TEXT UNIQUE NOT NULL,
+	order_id BIGINT NOT NULL,
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+CREATE INDEX idx_orders_user_id_id ON orders(user_id, id);
@@ -0,0 +1,11 @@
+CREATE TABLE order_stock_reservation(
+	reservation_id VARCHAR(64) PRIMARY KEY,
+	order_id BIGINT REFERENCES orders(id),
+	status INTEGER NOT NULL,
+	expire_time TIMESTAMP NOT NULL,
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	update_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_order_stock_reservation_order_id ON order_stock_reservation(order_id);
+CREATE INDEX idx_order_stock_reservation_status ON order_stock_reservation(status, expire_time);
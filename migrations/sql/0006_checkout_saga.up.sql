@@ -0,0 +1,14 @@
+CREATE TABLE checkout_saga(
+	id VARCHAR(64) PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	order_id BIGINT REFERENCES orders(id),
+	status INTEGER NOT NULL,
+	current_step INTEGER NOT NULL DEFAULT 0,
+	payload TEXT NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	update_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_checkout_saga_order_id ON checkout_saga(order_id);
+CREATE INDEX idx_checkout_saga_status ON checkout_saga(status, update_time);
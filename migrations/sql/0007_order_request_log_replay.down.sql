@@ -0,0 +1,3 @@
+ALTER TABLE order_request_log DROP COLUMN request_hash;
+ALTER TABLE order_request_log DROP COLUMN response_status;
+ALTER TABLE order_request_log DROP COLUMN order_id;
@@ -0,0 +1,3 @@
+ALTER TABLE order_request_log ADD COLUMN order_id BIGINT REFERENCES orders(id);
+ALTER TABLE order_request_log ADD COLUMN response_status INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_request_log ADD COLUMN request_hash VARCHAR(64) NOT NULL DEFAULT '';
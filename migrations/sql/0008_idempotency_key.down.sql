@@ -0,0 +1,2 @@
+DROP INDEX idx_order_request_log_create_time;
+DROP TABLE idempotency_key;
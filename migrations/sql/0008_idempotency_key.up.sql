@@ -0,0 +1,17 @@
+CREATE TABLE idempotency_key(
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	idempotency_key VARCHAR(255) NOT NULL,
+	method VARCHAR(10) NOT NULL,
+	path TEXT NOT NULL,
+	request_hash VARCHAR(64) NOT NULL,
+	status INTEGER NOT NULL,
+	response_status INTEGER NOT NULL DEFAULT 0,
+	response_body TEXT NOT NULL DEFAULT '',
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expire_time TIMESTAMP NOT NULL,
+	UNIQUE (user_id, idempotency_key)
+);
+
+CREATE INDEX idx_idempotency_key_expire_time ON idempotency_key(expire_time);
+CREATE INDEX idx_order_request_log_create_time ON order_request_log(create_time);
@@ -0,0 +1,3 @@
+ALTER TABLE orders DROP COLUMN currency;
+
+ALTER TABLE orders ALTER COLUMN amount TYPE NUMERIC;
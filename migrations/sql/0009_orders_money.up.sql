@@ -0,0 +1,3 @@
+ALTER TABLE orders ALTER COLUMN amount TYPE NUMERIC(20, 2);
+
+ALTER TABLE orders ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR';
@@ -0,0 +1,3 @@
+ALTER TABLE orders DROP COLUMN exchange_rate;
+ALTER TABLE orders DROP COLUMN base_currency;
+ALTER TABLE orders DROP COLUMN base_amount;
@@ -0,0 +1,9 @@
+ALTER TABLE orders ADD COLUMN base_amount NUMERIC(20, 2);
+ALTER TABLE orders ADD COLUMN base_currency CHAR(3);
+ALTER TABLE orders ADD COLUMN exchange_rate NUMERIC(20, 8) NOT NULL DEFAULT 1;
+
+-- orders placed before multi-currency were charged in the base currency
+UPDATE orders SET base_amount = amount, base_currency = currency WHERE base_amount IS NULL;
+
+ALTER TABLE orders ALTER COLUMN base_amount SET NOT NULL;
+ALTER TABLE orders ALTER COLUMN base_currency SET NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE order_detail DROP COLUMN discounts;
+
+DROP TABLE coupon_usage;
+DROP TABLE coupon;
@@ -0,0 +1,29 @@
+CREATE TABLE coupon(
+	id BIGSERIAL PRIMARY KEY,
+	code VARCHAR(64) UNIQUE NOT NULL,
+	type INTEGER NOT NULL,
+	value NUMERIC(20, 2) NOT NULL DEFAULT 0,
+	max_discount NUMERIC(20, 2) NOT NULL DEFAULT 0,
+	product_id BIGINT NOT NULL DEFAULT 0,
+	buy_qty BIGINT NOT NULL DEFAULT 0,
+	get_qty BIGINT NOT NULL DEFAULT 0,
+	min_spend NUMERIC(20, 2) NOT NULL DEFAULT 0,
+	max_uses_per_user INTEGER NOT NULL DEFAULT 0,
+	start_time TIMESTAMP,
+	end_time TIMESTAMP,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE coupon_usage(
+	id BIGSERIAL PRIMARY KEY,
+	coupon_id BIGINT NOT NULL REFERENCES coupon(id),
+	user_id BIGINT NOT NULL,
+	order_id BIGINT NOT NULL REFERENCES orders(id),
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (coupon_id, order_id)
+);
+
+CREATE INDEX coupon_usage_coupon_id_user_id_idx ON coupon_usage(coupon_id, user_id);
+
+ALTER TABLE order_detail ADD COLUMN discounts TEXT NOT NULL DEFAULT '[]';
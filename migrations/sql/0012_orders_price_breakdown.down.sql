@@ -0,0 +1,5 @@
+ALTER TABLE orders DROP COLUMN pricing_region;
+ALTER TABLE orders DROP COLUMN tax_amount;
+ALTER TABLE orders DROP COLUMN shipping_fee;
+ALTER TABLE orders DROP COLUMN discount_amount;
+ALTER TABLE orders DROP COLUMN subtotal;
@@ -0,0 +1,8 @@
+ALTER TABLE orders ADD COLUMN subtotal NUMERIC(20, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN discount_amount NUMERIC(20, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN shipping_fee NUMERIC(20, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN tax_amount NUMERIC(20, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN pricing_region VARCHAR(16) NOT NULL DEFAULT '';
+
+-- orders placed before the pricing pipeline were charged the item subtotal
+UPDATE orders SET subtotal = amount WHERE subtotal = 0;
@@ -0,0 +1,2 @@
+-- structured shipping address, NULL for orders placed with a legacy free-form address
+ALTER TABLE orders ADD COLUMN shipping_address_detail JSONB;
@@ -0,0 +1,14 @@
+CREATE TABLE user_address(
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	label VARCHAR(50) NOT NULL DEFAULT '',
+	address JSONB NOT NULL,
+	is_default BOOLEAN NOT NULL DEFAULT FALSE,
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	update_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX user_address_user_id_idx ON user_address(user_id);
+
+-- a user has at most one default address
+CREATE UNIQUE INDEX user_address_default_idx ON user_address(user_id) WHERE is_default;
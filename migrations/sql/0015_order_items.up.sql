@@ -0,0 +1,19 @@
+CREATE TABLE order_items(
+	id BIGSERIAL PRIMARY KEY,
+	order_id BIGINT NOT NULL REFERENCES orders(id),
+	product_id BIGINT NOT NULL,
+	quantity BIGINT NOT NULL,
+	unit_price NUMERIC(20, 2) NOT NULL,
+	base_unit_price NUMERIC(20, 2) NOT NULL,
+	weight BIGINT NOT NULL DEFAULT 0,
+	status INTEGER NOT NULL DEFAULT 0,
+	fulfilled_qty BIGINT NOT NULL DEFAULT 0,
+	cancelled_qty BIGINT NOT NULL DEFAULT 0,
+	refunded_qty BIGINT NOT NULL DEFAULT 0,
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	update_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	CHECK (fulfilled_qty + cancelled_qty <= quantity),
+	CHECK (refunded_qty <= fulfilled_qty)
+);
+
+CREATE INDEX order_items_order_id_idx ON order_items(order_id);
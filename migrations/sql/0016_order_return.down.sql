@@ -0,0 +1,3 @@
+DROP TABLE order_refund;
+DROP TABLE order_return_item;
+DROP TABLE order_return;
@@ -0,0 +1,40 @@
+CREATE TABLE order_return(
+	id BIGSERIAL PRIMARY KEY,
+	order_id BIGINT NOT NULL REFERENCES orders(id),
+	user_id BIGINT NOT NULL,
+	status INTEGER NOT NULL DEFAULT 0,
+	reason TEXT NOT NULL,
+	review_note TEXT NOT NULL DEFAULT '',
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	update_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX order_return_order_id_idx ON order_return(order_id);
+
+CREATE TABLE order_return_item(
+	id BIGSERIAL PRIMARY KEY,
+	return_id BIGINT NOT NULL REFERENCES order_return(id),
+	order_item_id BIGINT NOT NULL REFERENCES order_items(id),
+	quantity BIGINT NOT NULL CHECK (quantity > 0)
+);
+
+CREATE INDEX order_return_item_return_id_idx ON order_return_item(return_id);
+
+CREATE TABLE order_refund(
+	id BIGSERIAL PRIMARY KEY,
+	order_id BIGINT NOT NULL REFERENCES orders(id),
+	return_id BIGINT UNIQUE NOT NULL REFERENCES order_return(id),
+	status INTEGER NOT NULL DEFAULT 0,
+	subtotal NUMERIC(20, 2) NOT NULL,
+	discount_amount NUMERIC(20, 2) NOT NULL DEFAULT 0,
+	tax_amount NUMERIC(20, 2) NOT NULL DEFAULT 0,
+	amount NUMERIC(20, 2) NOT NULL,
+	currency CHAR(3) NOT NULL,
+	base_amount NUMERIC(20, 2) NOT NULL,
+	base_currency CHAR(3) NOT NULL,
+	failure_reason TEXT NOT NULL DEFAULT '',
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	update_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX order_refund_order_id_idx ON order_refund(order_id);
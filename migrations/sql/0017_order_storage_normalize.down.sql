@@ -0,0 +1,43 @@
+ALTER TABLE order_detail ADD COLUMN products TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE order_detail ADD COLUMN order_history TEXT NOT NULL DEFAULT '[]';
+
+-- rebuild the stringified products and history from the typed tables
+UPDATE order_detail od
+SET products = items.products
+FROM (
+	SELECT o.order_detail_id, json_agg(json_build_object(
+		'product_id', oi.product_id,
+		'quantity', oi.quantity,
+		'Price', oi.unit_price,
+		'BasePrice', oi.base_unit_price,
+		'Weight', oi.weight
+	) ORDER BY oi.id)::TEXT AS products
+	FROM order_items oi
+	JOIN orders o ON o.id = oi.order_id
+	GROUP BY o.order_detail_id
+) AS items
+WHERE od.id = items.order_detail_id;
+
+UPDATE order_detail od
+SET order_history = history.order_history
+FROM (
+	SELECT o.order_detail_id, json_agg(json_strip_nulls(json_build_object(
+		'status', sh.status,
+		'timestamp', to_json(sh.create_time::TIMESTAMPTZ) #>> '{}',
+		'reason', NULLIF(sh.reason, '')
+	)) ORDER BY sh.id)::TEXT AS order_history
+	FROM order_status_history sh
+	JOIN orders o ON o.id = sh.order_id
+	GROUP BY o.order_detail_id
+) AS history
+WHERE od.id = history.order_detail_id;
+
+ALTER TABLE order_detail ALTER COLUMN products DROP DEFAULT;
+ALTER TABLE order_detail ALTER COLUMN order_history DROP DEFAULT;
+
+ALTER TABLE order_detail ALTER COLUMN discounts DROP DEFAULT;
+ALTER TABLE order_detail ALTER COLUMN discounts TYPE TEXT USING discounts::TEXT;
+ALTER TABLE order_detail ALTER COLUMN discounts SET DEFAULT '[]';
+
+DROP INDEX order_items_product_id_idx;
+DROP TABLE order_status_history;
@@ -0,0 +1,73 @@
+-- parse text as jsonb, NULL when the text is not valid json
+CREATE OR REPLACE FUNCTION pg_temp.try_jsonb(value TEXT) RETURNS JSONB AS $$
+BEGIN
+	RETURN value::JSONB;
+EXCEPTION WHEN others THEN
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- parse text as a timestamp, NULL when the text is not a timestamp
+CREATE OR REPLACE FUNCTION pg_temp.try_timestamp(value TEXT) RETURNS TIMESTAMP AS $$
+BEGIN
+	RETURN value::TIMESTAMPTZ;
+EXCEPTION WHEN others THEN
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- keep only json arrays, anything else backfills nothing
+CREATE OR REPLACE FUNCTION pg_temp.json_array_or_empty(value TEXT) RETURNS JSONB AS $$
+	SELECT CASE WHEN jsonb_typeof(pg_temp.try_jsonb(value)) = 'array' THEN pg_temp.try_jsonb(value) ELSE '[]'::JSONB END;
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE TABLE order_status_history(
+	id BIGSERIAL PRIMARY KEY,
+	order_id BIGINT NOT NULL REFERENCES orders(id),
+	status VARCHAR(50) NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX order_status_history_order_id_idx ON order_status_history(order_id, id);
+
+CREATE INDEX order_items_product_id_idx ON order_items(product_id);
+
+-- line items of the orders saved before order_items, malformed products are skipped
+INSERT INTO order_items(order_id, product_id, quantity, unit_price, base_unit_price, weight, status, fulfilled_qty, cancelled_qty)
+SELECT
+	o.id,
+	(p.item->>'product_id')::BIGINT,
+	(p.item->>'quantity')::BIGINT,
+	COALESCE((p.item->>'Price')::NUMERIC, 0),
+	COALESCE(NULLIF((p.item->>'BasePrice')::NUMERIC, 0), (p.item->>'Price')::NUMERIC, 0),
+	COALESCE((p.item->>'Weight')::BIGINT, 0),
+	CASE o.status WHEN 2 THEN 3 WHEN 3 THEN 2 WHEN 4 THEN 2 ELSE 0 END,
+	CASE WHEN o.status = 2 THEN (p.item->>'quantity')::BIGINT ELSE 0 END,
+	CASE WHEN o.status IN (3, 4) THEN (p.item->>'quantity')::BIGINT ELSE 0 END
+FROM orders o
+JOIN order_detail od ON od.id = o.order_detail_id
+CROSS JOIN LATERAL jsonb_array_elements(pg_temp.json_array_or_empty(od.products)) AS p(item)
+WHERE jsonb_typeof(p.item->'product_id') = 'number'
+	AND jsonb_typeof(p.item->'quantity') = 'number'
+	AND NOT EXISTS (SELECT 1 FROM order_items oi WHERE oi.order_id = o.id)
+ORDER BY o.id;
+
+-- status timeline of every order, malformed entries are skipped
+INSERT INTO order_status_history(order_id, status, reason, create_time)
+SELECT
+	o.id,
+	h.entry->>'status',
+	COALESCE(h.entry->>'reason', ''),
+	COALESCE(pg_temp.try_timestamp(h.entry->>'timestamp'), o.create_time, CURRENT_TIMESTAMP)
+FROM orders o
+JOIN order_detail od ON od.id = o.order_detail_id
+CROSS JOIN LATERAL jsonb_array_elements(pg_temp.json_array_or_empty(od.order_history)) WITH ORDINALITY AS h(entry, position)
+WHERE jsonb_typeof(h.entry->'status') = 'string'
+ORDER BY o.id, h.position;
+
+ALTER TABLE order_detail ALTER COLUMN discounts DROP DEFAULT;
+ALTER TABLE order_detail ALTER COLUMN discounts TYPE JSONB USING pg_temp.json_array_or_empty(discounts);
+ALTER TABLE order_detail ALTER COLUMN discounts SET DEFAULT '[]'::JSONB;
+
+ALTER TABLE order_detail DROP COLUMN products, DROP COLUMN order_history;
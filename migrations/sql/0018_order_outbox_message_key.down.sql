@@ -0,0 +1 @@
+DROP INDEX idx_order_outbox_message_key_id;
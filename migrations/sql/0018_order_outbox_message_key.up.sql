@@ -0,0 +1 @@
+CREATE INDEX idx_order_outbox_message_key_id ON order_outbox(message_key, id) WHERE status = 0;
@@ -0,0 +1,3 @@
+DROP INDEX idx_order_request_log_user_token;
+ALTER TABLE order_request_log ADD CONSTRAINT order_request_log_idempotency_token_key UNIQUE (idempotency_token);
+ALTER TABLE order_request_log DROP COLUMN user_id;
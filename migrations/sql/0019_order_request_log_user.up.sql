@@ -0,0 +1,4 @@
+ALTER TABLE order_request_log ADD COLUMN user_id BIGINT NOT NULL DEFAULT 0;
+UPDATE order_request_log l SET user_id = o.user_id FROM orders o WHERE o.id = l.order_id;
+ALTER TABLE order_request_log DROP CONSTRAINT order_request_log_idempotency_token_key;
+CREATE UNIQUE INDEX idx_order_request_log_user_token ON order_request_log(user_id, idempotency_token);
@@ -0,0 +1 @@
+ALTER TABLE idempotency_key ADD COLUMN lock_expire_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1 @@
+DROP TABLE order_stock_item_release;
@@ -0,0 +1,11 @@
+CREATE TABLE order_stock_item_release(
+	release_id VARCHAR(255) PRIMARY KEY,
+	order_id BIGINT NOT NULL REFERENCES orders(id),
+	items JSONB NOT NULL,
+	status INTEGER NOT NULL,
+	create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	update_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_order_stock_item_release_order_id ON order_stock_item_release(order_id);
+CREATE INDEX idx_order_stock_item_release_status ON order_stock_item_release(status, create_time);
@@ -0,0 +1 @@
+ALTER TABLE order_refund DROP COLUMN attempt;
@@ -0,0 +1,2 @@
+ALTER TABLE order_refund ADD COLUMN attempt INTEGER NOT NULL DEFAULT 1;
+UPDATE order_refund SET failure_reason = '' WHERE status <> 2;
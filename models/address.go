@@ -0,0 +1,108 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+type Address struct {
+	RecipientName string `json:"recipient_name"`
+	Phone         string `json:"phone"`
+	Line1         string `json:"line1"`
+	Line2         string `json:"line2,omitempty"`
+	City          string `json:"city"`
+	Region        string `json:"region,omitempty"` // ISO 3166-2 code of the province or state, e.g. JB
+	PostalCode    string `json:"postal_code"`
+	Country       string `json:"country"` // ISO 3166-1 alpha-2
+}
+
+// String format the address on one line, it's what the legacy shipping_address column keeps
+func (a Address) String() string {
+	parts := make([]string, 0, 8)
+	for _, part := range []string{a.RecipientName, a.Phone, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Value store the address as JSONB
+func (a Address) Value() (driver.Value, error) {
+	value, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(value), nil
+}
+
+// Scan read an address from a JSONB column
+func (a *Address) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	default:
+		return errors.New("invalid address")
+	}
+}
+
+// ShippingAddress is the shipping address of a checkout request. It holds a structured address,
+// or the free-form string still sent by older clients in Legacy.
+type ShippingAddress struct {
+	Address *Address
+	Legacy  string
+}
+
+func (s ShippingAddress) MarshalJSON() ([]byte, error) {
+	if s.Address != nil {
+		return json.Marshal(s.Address)
+	}
+	return json.Marshal(s.Legacy)
+}
+
+func (s *ShippingAddress) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*s = ShippingAddress{}
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		s.Address = nil
+		return json.Unmarshal(data, &s.Legacy)
+	default:
+		s.Legacy = ""
+		s.Address = &Address{}
+		return json.Unmarshal(data, s.Address)
+	}
+}
+
+// String return the one line form of the address
+func (s ShippingAddress) String() string {
+	if s.Address != nil {
+		return s.Address.String()
+	}
+	return s.Legacy
+}
+
+// UserAddress is an address saved in the address book of a user
+type UserAddress struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"-"`
+	Label      string    `json:"label"`
+	Address    Address   `json:"address"`
+	IsDefault  bool      `json:"is_default"`
+	CreateTime time.Time `json:"create_time"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+type UserAddressRequest struct {
+	Label     string  `json:"label"`
+	Address   Address `json:"address"`
+	IsDefault bool    `json:"is_default"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"order_service/money"
+	"time"
+)
+
+// Coupon amounts (value of fixed coupons, max_discount, min_spend) are in the catalog currency.
+// The value of a percentage coupon is the percentage, e.g. 12.50.
+type Coupon struct {
+	ID             int64
+	Code           string
+	Type           int
+	Value          money.Amount
+	MaxDiscount    money.Amount // 0 means no cap
+	ProductID      int64        // product of a buy x get y coupon
+	BuyQty         int64
+	GetQty         int64
+	MinSpend       money.Amount
+	MaxUsesPerUser int // 0 means unlimited
+	StartTime      *time.Time
+	EndTime        *time.Time
+	Active         bool
+	CreateTime     time.Time
+}
+
+type CouponUsage struct {
+	ID         int64
+	CouponID   int64
+	UserID     int64
+	OrderID    int64
+	CreateTime time.Time
+}
+
+// AppliedDiscount is a coupon applied to an order. Amount is in the order currency
+// and BaseAmount in the catalog currency.
+type AppliedDiscount struct {
+	CouponID     int64        `json:"coupon_id"`
+	Code         string       `json:"code"`
+	Type         string       `json:"type"`
+	Amount       money.Amount `json:"amount"`
+	BaseAmount   money.Amount `json:"base_amount"`
+	FreeShipping bool         `json:"free_shipping,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type IdempotencyKey struct {
+	ID             int64
+	UserID         int64
+	IdempotencyKey string
+	Method         string
+	Path           string
+	RequestHash    string
+	Status         int
+	ResponseStatus int
+	ResponseBody   string
+	CreateTime     time.Time
+	ExpireTime     time.Time
+	LockExpireTime time.Time // a running request past it is taken over by a retry
+}
@@ -1,80 +1,226 @@
 package models
 
-import "time"
+import (
+	"order_service/money"
+	"time"
+)
 
 type Order struct {
-	ID              int64   `json:"id"`
-	UserID          int64   `json:"user_id"`
-	Amount          float64 `json:"amount"`
-	TotalQty        int     `json:"total_qty"`
-	OrderDetailID   int64   `json:"order_detail_id"`
-	Status          int     `json:"status"`
-	PaymentMethod   string  `json:"payment_method"`
-	ShippingAddress string  `json:"shipping_address"`
+	ID                    int64          `json:"id"`
+	UserID                int64          `json:"user_id"`
+	Amount                money.Amount   `json:"amount"`
+	Currency              money.Currency `json:"currency"`
+	Subtotal              money.Amount   `json:"subtotal"`
+	DiscountAmount        money.Amount   `json:"discount_amount"`
+	ShippingFee           money.Amount   `json:"shipping_fee"`
+	TaxAmount             money.Amount   `json:"tax_amount"`
+	PricingRegion         string         `json:"pricing_region"`
+	BaseAmount            money.Amount   `json:"base_amount"`
+	BaseCurrency          money.Currency `json:"base_currency"`
+	ExchangeRate          money.Rate     `json:"exchange_rate"`
+	TotalQty              int            `json:"total_qty"`
+	OrderDetailID         int64          `json:"order_detail_id"`
+	Status                int            `json:"status"`
+	PaymentMethod         string         `json:"payment_method"`
+	ShippingAddress       string         `json:"shipping_address"`
+	ShippingAddressDetail *Address       `json:"shipping_address_detail"`
+	CreateTime            time.Time      `json:"create_time" gorm:"autoCreateTime"`
 }
 
 type OrderDetail struct {
-	ID           int64
-	Products     string // stringfy json
-	OrderHistory string // stringfy json
+	ID        int64
+	Discounts []AppliedDiscount `gorm:"serializer:json"`
+}
+
+// OrderStatusHistory is an entry of the timeline of an order: its status changes
+// and the steps of its cancellations, returns and refunds
+type OrderStatusHistory struct {
+	ID         int64
+	OrderID    int64
+	Status     string
+	Reason     string
+	CreateTime time.Time `gorm:"autoCreateTime"`
 }
 
 type CheckoutItem struct {
 	ProductID int64 `json:"product_id"`
 	Quantity  int64 `json:"quantity"`
-	Price     float64
+	Price     money.Amount
+	BasePrice money.Amount
+	Weight    int64 // grams per unit
 }
 
 type CheckoutRequest struct {
-	UserID           int64          `json:"user_id"`
-	Items            []CheckoutItem `json:"items"`
-	PaymentMethod    string         `json:"payment_method"`
-	ShippingAddress  string         `json:"shipping_address"`
-	IdempotencyToken string         `json:"idempotency_token"`
+	UserID           int64           `json:"user_id"`
+	Items            []CheckoutItem  `json:"items"`
+	PaymentMethod    string          `json:"payment_method"`
+	ShippingAddress  ShippingAddress `json:"shipping_address"` // structured address or legacy string
+	ShippingRegion   string          `json:"shipping_region"`  // region of a legacy string address, empty means the default region
+	AddressID        int64           `json:"address_id"`       // saved address used instead of ShippingAddress
+	Currency         money.Currency  `json:"currency"`         // empty means the catalog currency
+	CouponCodes      []string        `json:"coupon_codes"`
+	IdempotencyToken string          `json:"idempotency_token"`
 }
 
 type OrderRequestLog struct {
 	ID               int64     `json:"id"`
+	UserID           int64     `json:"user_id"`
 	IdempotencyToken string    `json:"idempotency_token"`
+	OrderID          *int64    `json:"order_id"`
+	ResponseStatus   int       `json:"response_status"`
+	RequestHash      string    `json:"request_hash"`
 	CreateTime       time.Time `json:"create_time"`
 }
 
 type OrderHistoryParam struct {
-	UserID int64
-	Status int
+	UserID    int64
+	Statuses  []int
+	From      *time.Time
+	To        *time.Time
+	ProductID int64 // only orders with an item of this product when greater than zero
+	Cursor    int64 // id of the last order on the previous page, 0 for the first page
+	Limit     int
+	Sort      string
+}
+
+type OrderHistoryPage struct {
+	Orders     []OrderHistoryResponse `json:"data"`
+	NextCursor string                 `json:"next_cursor"`
 }
 
 type OrderHistoryResponse struct {
-	OrderID         int64           `json:"order_id"`
-	TotalAmount     float64         `json:"total_amount"`
-	TotalQty        int             `json:"total_qty"`
-	Status          string          `json:"status"`
-	PaymentMethod   string          `json:"payment_method"`
-	ShippingAddress string          `json:"shipping_address"`
-	Products        []CheckoutItem  `json:"products"`
-	History         []StatusHistory `json:"history"`
+	OrderID               int64             `json:"order_id"`
+	TotalAmount           money.Amount      `json:"total_amount"`
+	Currency              money.Currency    `json:"currency"`
+	PriceBreakdown        PriceBreakdown    `json:"price_breakdown"`
+	PricingRegion         string            `json:"pricing_region"`
+	BaseAmount            money.Amount      `json:"base_amount"`
+	BaseCurrency          money.Currency    `json:"base_currency"`
+	ExchangeRate          money.Rate        `json:"exchange_rate"`
+	TotalQty              int               `json:"total_qty"`
+	Status                string            `json:"status"`
+	PaymentMethod         string            `json:"payment_method"`
+	ShippingAddress       string            `json:"shipping_address"`
+	ShippingAddressDetail *Address          `json:"shipping_address_detail"`
+	Products              []CheckoutItem    `json:"products"`
+	Discounts             []AppliedDiscount `json:"discounts"`
+	History               []StatusHistory   `json:"history"`
+}
+
+type OrderDetailResponse struct {
+	OrderHistoryResponse
+	Items      []OrderItemResponse `json:"items"`
+	CreateTime time.Time           `json:"create_time"`
+	UpdateTime time.Time           `json:"update_time"`
 }
 
 type StatusHistory struct {
 	Status    string `json:"status"`
 	Timestamp string `json:"timestamp"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type OrderStatusParam struct {
+	OrderID  int64
+	UserID   int64
+	Status   int
+	Reason   string
+	EventKey string // set when the transition comes from a consumed event, used to skip redeliveries
+}
+
+type OrderStatusRequest struct {
+	Reason string `json:"reason"`
 }
 
 type OrderHistoryResult struct {
-	ID              int64 `gorm:"column:id"`
-	Amount          float64
-	TotalQty        int
-	Status          int
-	PaymentMethod   string
-	ShippingAddress string
-	Products        string `gorm:"column:products"`
-	History         string `gorm:"column:order_history"`
+	ID                    int64 `gorm:"column:id"`
+	Amount                money.Amount
+	Currency              money.Currency
+	Subtotal              money.Amount
+	DiscountAmount        money.Amount
+	ShippingFee           money.Amount
+	TaxAmount             money.Amount
+	PricingRegion         string
+	BaseAmount            money.Amount
+	BaseCurrency          money.Currency
+	ExchangeRate          money.Rate
+	TotalQty              int
+	Status                int
+	PaymentMethod         string
+	ShippingAddress       string
+	ShippingAddressDetail *Address
+	CreateTime            time.Time
+	UpdateTime            time.Time
+	Discounts             []AppliedDiscount `gorm:"serializer:json"`
 }
 
 type OrderCreatedEvent struct {
-	OrderID         int64   `json:"order_id"`
-	UserID          int64   `json:"user_id"`
-	TotalAmount     float64 `json:"total_amount"`
-	PaymentMethod   string  `json:"payment_method"`
-	ShippingAddress string  `json:"shipping_address"`
+	OrderID               int64             `json:"order_id"`
+	UserID                int64             `json:"user_id"`
+	TotalAmount           money.Amount      `json:"total_amount"`
+	Currency              money.Currency    `json:"currency"`
+	PriceBreakdown        PriceBreakdown    `json:"price_breakdown"`
+	BaseAmount            money.Amount      `json:"base_amount"`
+	BaseCurrency          money.Currency    `json:"base_currency"`
+	ExchangeRate          money.Rate        `json:"exchange_rate"`
+	Discounts             []AppliedDiscount `json:"discounts"`
+	PaymentMethod         string            `json:"payment_method"`
+	ShippingAddress       string            `json:"shipping_address"`
+	ShippingAddressDetail *Address          `json:"shipping_address_detail,omitempty"`
+}
+
+type OrderCancelledEvent struct {
+	OrderID       int64            `json:"order_id"`
+	UserID        int64            `json:"user_id"`
+	Reason        string           `json:"reason"`
+	Items         []OrderEventItem `json:"items"`
+	TotalAmount   money.Amount     `json:"total_amount"`
+	Currency      money.Currency   `json:"currency"`
+	BaseAmount    money.Amount     `json:"base_amount"`
+	BaseCurrency  money.Currency   `json:"base_currency"`
+	ExchangeRate  money.Rate       `json:"exchange_rate"`
+	PaymentMethod string           `json:"payment_method"`
+	CancelTime    time.Time        `json:"cancel_time"`
+}
+
+// OrderEventItem is a line item of an order event, Price is in the order currency
+type OrderEventItem struct {
+	ProductID int64        `json:"product_id"`
+	Quantity  int64        `json:"quantity"`
+	Price     money.Amount `json:"price"`
+}
+
+// PaymentRequestedEvent ask payment to charge an order. PaymentRequestID is the same for every
+// retry of the request so payment charges the order once.
+type PaymentRequestedEvent struct {
+	PaymentRequestID string         `json:"payment_request_id"`
+	OrderID          int64          `json:"order_id"`
+	UserID           int64          `json:"user_id"`
+	Amount           money.Amount   `json:"amount"`
+	Currency         money.Currency `json:"currency"`
+	PaymentMethod    string         `json:"payment_method"`
+	RequestTime      time.Time      `json:"request_time"`
+}
+
+// PaymentCancelledEvent ask payment to void the charge of a rolled back checkout, or to pay it back
+// when it was already captured
+type PaymentCancelledEvent struct {
+	PaymentRequestID string    `json:"payment_request_id"`
+	OrderID          int64     `json:"order_id"`
+	UserID           int64     `json:"user_id"`
+	Reason           string    `json:"reason"`
+	CancelTime       time.Time `json:"cancel_time"`
+}
+
+type PaymentResultEvent struct {
+	OrderID   int64  `json:"order_id"`
+	PaymentID string `json:"payment_id"`
+	Reason    string `json:"reason"`
+}
+
+type OrderProcessedEvent struct {
+	ID         int64
+	EventKey   string
+	OrderID    int64
+	CreateTime time.Time
 }
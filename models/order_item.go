@@ -0,0 +1,77 @@
+package models
+
+import (
+	"order_service/money"
+	"time"
+)
+
+// OrderItem is a line of an order. UnitPrice is in the order currency and BaseUnitPrice in the
+// catalog currency. Cancelled units never ship, fulfilled units were shipped and refunded units
+// are the fulfilled ones that were paid back.
+type OrderItem struct {
+	ID            int64
+	OrderID       int64
+	ProductID     int64
+	Quantity      int64
+	UnitPrice     money.Amount
+	BaseUnitPrice money.Amount
+	Weight        int64 // grams per unit
+	Status        int
+	FulfilledQty  int64
+	CancelledQty  int64
+	RefundedQty   int64
+	CreateTime    time.Time `gorm:"autoCreateTime"`
+	UpdateTime    time.Time `gorm:"autoUpdateTime"`
+}
+
+// OpenQty is the quantity that is neither cancelled nor fulfilled yet
+func (i OrderItem) OpenQty() int64 {
+	return i.Quantity - i.CancelledQty - i.FulfilledQty
+}
+
+type OrderItemResponse struct {
+	ItemID       int64        `json:"item_id"`
+	ProductID    int64        `json:"product_id"`
+	Quantity     int64        `json:"quantity"`
+	UnitPrice    money.Amount `json:"unit_price"`
+	Status       string       `json:"status"`
+	FulfilledQty int64        `json:"fulfilled_qty"`
+	CancelledQty int64        `json:"cancelled_qty"`
+	RefundedQty  int64        `json:"refunded_qty"`
+}
+
+type OrderItemCancel struct {
+	ItemID   int64 `json:"item_id"`
+	Quantity int64 `json:"quantity"`
+}
+
+type OrderItemCancelRequest struct {
+	Items  []OrderItemCancel `json:"items"`
+	Reason string            `json:"reason"`
+}
+
+type OrderItemCancelParam struct {
+	OrderID int64
+	UserID  int64
+	Items   []OrderItemCancel
+	Reason  string
+}
+
+// OrderItemsCancelledEvent is published when part of an order is cancelled. Items carry the
+// cancelled quantities and the amounts are the order totals after the cancellation. The stock is
+// given back through the order's stock reservation, inventory must not restock from this event.
+type OrderItemsCancelledEvent struct {
+	OrderID        int64            `json:"order_id"`
+	UserID         int64            `json:"user_id"`
+	Reason         string           `json:"reason"`
+	Items          []OrderEventItem `json:"items"`
+	PreviousAmount money.Amount     `json:"previous_amount"`
+	TotalAmount    money.Amount     `json:"total_amount"`
+	Currency       money.Currency   `json:"currency"`
+	BaseAmount     money.Amount     `json:"base_amount"`
+	BaseCurrency   money.Currency   `json:"base_currency"`
+	ExchangeRate   money.Rate       `json:"exchange_rate"`
+	PriceBreakdown PriceBreakdown   `json:"price_breakdown"`
+	PaymentMethod  string           `json:"payment_method"`
+	CancelTime     time.Time        `json:"cancel_time"`
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"order_service/money"
+	"time"
+)
+
+// OrderReturn is a customer request to send back fulfilled items of an order
+type OrderReturn struct {
+	ID         int64
+	OrderID    int64
+	UserID     int64
+	Status     int
+	Reason     string
+	ReviewNote string
+	CreateTime time.Time `gorm:"autoCreateTime"`
+	UpdateTime time.Time `gorm:"autoUpdateTime"`
+}
+
+type OrderReturnItem struct {
+	ID          int64
+	ReturnID    int64
+	OrderItemID int64
+	Quantity    int64
+}
+
+// OrderRefund is the money paid back for a received return. Amounts are in the order currency:
+// Amount = Subtotal - DiscountAmount + TaxAmount, shipping is not refunded. Attempt counts the
+// requests sent to payment, a failed refund can be requested again.
+type OrderRefund struct {
+	ID             int64
+	OrderID        int64
+	ReturnID       int64
+	Status         int
+	Attempt        int
+	Subtotal       money.Amount
+	DiscountAmount money.Amount
+	TaxAmount      money.Amount
+	Amount         money.Amount
+	Currency       money.Currency
+	BaseAmount     money.Amount
+	BaseCurrency   money.Currency
+	FailureReason  string    // only set on a failed refund
+	CreateTime     time.Time `gorm:"autoCreateTime"`
+	UpdateTime     time.Time `gorm:"autoUpdateTime"`
+}
+
+type OrderReturnItemRequest struct {
+	ItemID   int64 `json:"item_id"`
+	Quantity int64 `json:"quantity"`
+}
+
+type OrderReturnRequest struct {
+	Items  []OrderReturnItemRequest `json:"items"`
+	Reason string                   `json:"reason"`
+}
+
+type OrderReturnParam struct {
+	OrderID int64
+	UserID  int64
+	Items   []OrderReturnItemRequest
+	Reason  string
+}
+
+type ReturnReviewRequest struct {
+	Note string `json:"note"`
+}
+
+type ReturnReviewParam struct {
+	ReturnID int64
+	Status   int
+	Note     string
+}
+
+type OrderReturnResponse struct {
+	ReturnID   int64                    `json:"return_id"`
+	OrderID    int64                    `json:"order_id"`
+	Status     string                   `json:"status"`
+	Reason     string                   `json:"reason"`
+	ReviewNote string                   `json:"review_note,omitempty"`
+	Items      []OrderReturnItemRequest `json:"items"`
+	Refund     *OrderRefundResponse     `json:"refund,omitempty"`
+	CreateTime time.Time                `json:"create_time"`
+	UpdateTime time.Time                `json:"update_time"`
+}
+
+type OrderRefundResponse struct {
+	RefundID       int64          `json:"refund_id"`
+	Status         string         `json:"status"`
+	Subtotal       money.Amount   `json:"subtotal"`
+	DiscountAmount money.Amount   `json:"discount_amount"`
+	TaxAmount      money.Amount   `json:"tax_amount"`
+	Amount         money.Amount   `json:"amount"`
+	Currency       money.Currency `json:"currency"`
+	Attempt        int            `json:"attempt"`
+	FailureReason  string         `json:"failure_reason,omitempty"`
+}
+
+// OrderRefundRequestedEvent ask payment to pay a refund back. Payment sends the attempt back with
+// the refund result.
+type OrderRefundRequestedEvent struct {
+	RefundID       int64            `json:"refund_id"`
+	Attempt        int              `json:"attempt"`
+	ReturnID       int64            `json:"return_id"`
+	OrderID        int64            `json:"order_id"`
+	UserID         int64            `json:"user_id"`
+	Items          []OrderEventItem `json:"items"`
+	Subtotal       money.Amount     `json:"subtotal"`
+	DiscountAmount money.Amount     `json:"discount_amount"`
+	TaxAmount      money.Amount     `json:"tax_amount"`
+	Amount         money.Amount     `json:"amount"`
+	Currency       money.Currency   `json:"currency"`
+	BaseAmount     money.Amount     `json:"base_amount"`
+	BaseCurrency   money.Currency   `json:"base_currency"`
+	ExchangeRate   money.Rate       `json:"exchange_rate"`
+	PaymentMethod  string           `json:"payment_method"`
+	RequestTime    time.Time        `json:"request_time"`
+}
+
+type RefundResultEvent struct {
+	RefundID int64  `json:"refund_id"`
+	Attempt  int    `json:"attempt"` // 0 from payment versions that don't send it, taken as the first attempt
+	OrderID  int64  `json:"order_id"`
+	Reason   string `json:"reason"`
+}
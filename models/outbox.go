@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type OrderOutbox struct {
+	ID              int64
+	AggregateID     int64
+	Topic           string
+	MessageKey      string
+	Payload         string // stringfy json
+	Status          int
+	Attempts        int
+	LastError       string
+	NextAttemptTime time.Time
+	CreateTime      time.Time
+	SentTime        *time.Time
+}
@@ -0,0 +1,12 @@
+package models
+
+import "order_service/money"
+
+// PaymentMethod is a payment method accepted at checkout, amount limits are in the catalog currency
+type PaymentMethod struct {
+	Code       string           `json:"code"`
+	Name       string           `json:"name"`
+	Currencies []money.Currency `json:"currencies,omitempty"`
+	MinAmount  money.Amount     `json:"min_amount,omitempty"`
+	MaxAmount  money.Amount     `json:"max_amount,omitempty"`
+}
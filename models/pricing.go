@@ -0,0 +1,32 @@
+package models
+
+import "order_service/money"
+
+// PriceBreakdown is the price of an order stage by stage, GrandTotal = Subtotal - Discount + ShippingFee + Tax
+type PriceBreakdown struct {
+	Subtotal    money.Amount `json:"subtotal"`
+	Discount    money.Amount `json:"discount"`
+	ShippingFee money.Amount `json:"shipping_fee"`
+	Tax         money.Amount `json:"tax"`
+	GrandTotal  money.Amount `json:"grand_total"`
+}
+
+// PricingInput is what the pricing pipeline prices. With Base set the order is priced in the
+// catalog currency, otherwise in the order currency using ExchangeRate.
+type PricingInput struct {
+	Items        []CheckoutItem
+	Discounts    []AppliedDiscount
+	ExchangeRate money.Rate
+	Region       string
+	Base         bool
+}
+
+// CheckoutQuote is what a checkout is charged, fixed when the request is validated so a resumed saga
+// saves the order with the same prices, rate, discounts and fees
+type CheckoutQuote struct {
+	ExchangeRate money.Rate
+	Discounts    []AppliedDiscount
+	Region       string
+	Pricing      PriceBreakdown // in the order currency
+	BasePricing  PriceBreakdown // in the catalog currency
+}
@@ -1,14 +1,33 @@
 package models
 
+import "order_service/money"
+
 type GetProductInfo struct {
 	Product `json:"product"`
 }
 
 type Product struct {
-	ID          int64   `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Stock       int64   `json:"stock"`
-	CategoryID  int64   `json:"category_id"`
+	ID          int64        `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Price       money.Amount `json:"price"`
+	Stock       int64        `json:"stock"`
+	Weight      int64        `json:"weight"` // grams
+	CategoryID  int64        `json:"category_id"`
+}
+
+type StockReservationItem struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int64 `json:"quantity"`
+}
+
+type StockReservationRequest struct {
+	ReservationID string                 `json:"reservation_id"`
+	Items         []StockReservationItem `json:"items"`
+	TTLSeconds    int64                  `json:"ttl_seconds"`
+}
+
+type StockReleaseRequest struct {
+	ReleaseID string                 `json:"release_id"`
+	Items     []StockReservationItem `json:"items"`
 }
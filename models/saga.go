@@ -0,0 +1,47 @@
+package models
+
+import (
+	"order_service/money"
+	"time"
+)
+
+type CheckoutSaga struct {
+	ID          string `gorm:"primaryKey"`
+	UserID      int64
+	OrderID     *int64
+	Status      int
+	CurrentStep int    // index of the next step to execute, or of the last step to compensate plus one
+	Payload     string // stringfy json of CheckoutSagaData
+	LastError   string
+	CreateTime  time.Time
+	UpdateTime  time.Time
+}
+
+type CheckoutSagaData struct {
+	Request       CheckoutRequest   `json:"request"`
+	RequestHash   string            `json:"request_hash"`
+	ReservationID string            `json:"reservation_id"`
+	ExchangeRate  money.Rate        `json:"exchange_rate"`
+	Discounts     []AppliedDiscount `json:"discounts"`
+	Region        string            `json:"region"`
+	Pricing       *PriceBreakdown   `json:"pricing"`
+	BasePricing   *PriceBreakdown   `json:"base_pricing"`
+	OrderID       int64             `json:"order_id"`
+}
+
+type CheckoutSagaResponse struct {
+	SagaID     string    `json:"saga_id"`
+	Status     string    `json:"status"`
+	Step       string    `json:"step"`
+	OrderID    *int64    `json:"order_id"`
+	Error      string    `json:"error,omitempty"`
+	CreateTime time.Time `json:"create_time"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+type CheckoutResponse struct {
+	OrderID        int64  `json:"order_id"`
+	SagaID         string `json:"saga_id"`
+	ResponseStatus int    `json:"-"`
+	Replayed       bool   `json:"-"`
+}
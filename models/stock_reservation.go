@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type StockReservation struct {
+	ReservationID string `gorm:"primaryKey"`
+	OrderID       *int64
+	Status        int
+	ExpireTime    time.Time
+	CreateTime    time.Time
+	UpdateTime    time.Time
+}
+
+type StockReservationResult struct {
+	StockReservation
+	OrderStatus *int
+}
+
+// StockItemRelease give back part of the stock reservation of an order, it is recorded with the
+// cancellation of some of its items and stays pending until the product service applied it.
+type StockItemRelease struct {
+	ReleaseID  string `gorm:"primaryKey"`
+	OrderID    int64
+	Items      []StockReservationItem `gorm:"serializer:json"`
+	Status     int
+	CreateTime time.Time
+	UpdateTime time.Time
+}
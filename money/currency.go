@@ -0,0 +1,46 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidCurrency = errors.New("invalid currency code")
+
+// Currency is an ISO 4217 alphabetic currency code
+type Currency string
+
+// minorDigits lists the ISO 4217 currencies whose minor unit is not 1/100. An Amount always keeps
+// Scale decimals, so these currencies would be charged fractions they can't settle (JPY) or lose a
+// digit (KWD), and are rejected. IDR is 2 digits in ISO 4217 even though prices are usually shown whole.
+var minorDigits = map[Currency]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// ParseCurrency normalize a currency code to upper case. Currencies whose minor unit doesn't
+// match the Scale of an Amount are rejected.
+func ParseCurrency(code string) (Currency, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", ErrInvalidCurrency
+	}
+
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return "", ErrInvalidCurrency
+		}
+	}
+
+	if digits, ok := minorDigits[Currency(code)]; ok && digits != Scale {
+		return "", fmt.Errorf("%w: %s has %d minor digits, amounts keep %d", ErrInvalidCurrency, code, digits, Scale)
+	}
+	return Currency(code), nil
+}
+
+func (c Currency) String() string {
+	return string(c)
+}
@@ -0,0 +1,38 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCurrency(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Currency
+		wantErr bool
+	}{
+		{input: "usd", want: "USD"},
+		{input: " idr ", want: "IDR"},
+		{input: "SGD", want: "SGD"},
+		{input: "US", wantErr: true},
+		{input: "US1", wantErr: true},
+		{input: "", wantErr: true},
+		// minor unit doesn't match the 2 decimals of an Amount
+		{input: "JPY", wantErr: true},
+		{input: "krw", wantErr: true},
+		{input: "KWD", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCurrency(tt.input)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidCurrency) {
+				t.Fatalf("ParseCurrency(%q) error = %v, want ErrInvalidCurrency", tt.input, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Fatalf("ParseCurrency(%q) = %s, %v, want %s", tt.input, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places kept by an Amount, whatever its currency. ParseCurrency
+// rejects the currencies whose minor unit is not 1/100.
+const Scale = 2
+
+const unitsPerWhole = 100
+
+var (
+	ErrInvalidAmount = errors.New("invalid money amount")
+	ErrOverflow      = errors.New("money amount overflow")
+)
+
+// Amount is a money value stored as an integer number of minor units (1/100 of the currency unit)
+// so sums and multiplications are exact. Values with more than Scale decimals are rounded half to even
+// when parsed, which is the only place rounding happens.
+type Amount int64
+
+// FromMinorUnits build an Amount from a number of minor units, e.g. 1050 is 10.50
+func FromMinorUnits(units int64) Amount {
+	return Amount(units)
+}
+
+// Parse read a decimal string such as "10.5", "-3" or "1.25e3" into an Amount
+func Parse(value string) (Amount, error) {
+	rat, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	units, err := scaleHalfEven(rat, unitsPerWhole)
+	return Amount(units), err
+}
+
+// scaleHalfEven multiply a rational number by factor and round it half to even to an int64
+func scaleHalfEven(rat *big.Rat, factor int64) (int64, error) {
+	scaled := new(big.Rat).Mul(rat, new(big.Rat).SetInt64(factor))
+
+	quo, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if rem.Sign() != 0 {
+		// compare twice the remainder against the denominator to find which side of the half we're on
+		cmp := new(big.Int).Abs(new(big.Int).Lsh(rem, 1)).Cmp(scaled.Denom())
+		if cmp > 0 || (cmp == 0 && quo.Bit(0) == 1) {
+			if rem.Sign() > 0 {
+				quo.Add(quo, big.NewInt(1))
+			} else {
+				quo.Sub(quo, big.NewInt(1))
+			}
+		}
+	}
+
+	if !quo.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return quo.Int64(), nil
+}
+
+// MinorUnits return the amount as a number of minor units
+func (a Amount) MinorUnits() int64 {
+	return int64(a)
+}
+
+// Add return a + b, failing instead of wrapping around on overflow
+func (a Amount) Add(b Amount) (Amount, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, ErrOverflow
+	}
+	return a + b, nil
+}
+
+// Mul return the amount multiplied by a quantity, failing instead of wrapping around on overflow
+func (a Amount) Mul(quantity int64) (Amount, error) {
+	if a == 0 || quantity == 0 {
+		return 0, nil
+	}
+
+	result := a * Amount(quantity)
+	if result/Amount(quantity) != a || (a == -1 && quantity == math.MinInt64) || (quantity == -1 && a == math.MinInt64) {
+		return 0, ErrOverflow
+	}
+	return result, nil
+}
+
+// String format the amount with exactly Scale decimals, e.g. "10.50"
+func (a Amount) String() string {
+	sign := ""
+	units := uint64(a)
+	if a < 0 {
+		sign = "-"
+		units = uint64(-(a + 1)) + 1 // avoid overflowing on math.MinInt64
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units/unitsPerWhole, units%unitsPerWhole)
+}
+
+// MarshalJSON encode the amount as a JSON number so the API keeps its numeric shape
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accept a JSON number or a quoted decimal string without going through float64
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if value == "null" {
+		return nil
+	}
+
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Value store the amount as a decimal string so NUMERIC columns receive it exactly
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan read a NUMERIC column back into an Amount
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case int64:
+		return a.scanString(strconv.FormatInt(v, 10))
+	case float64:
+		return a.scanString(strconv.FormatFloat(v, 'f', -1, 64))
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidAmount, src)
+	}
+}
+
+func (a *Amount) scanString(value string) error {
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// MulRatio return the amount multiplied by numerator/denominator, rounding half to even
+func (a Amount) MulRatio(numerator int64, denominator int64) (Amount, error) {
+	if denominator == 0 {
+		return 0, fmt.Errorf("%w: zero denominator", ErrInvalidAmount)
+	}
+
+	rat := new(big.Rat).SetFrac(
+		new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(numerator)),
+		big.NewInt(denominator),
+	)
+
+	units, err := scaleHalfEven(rat, 1)
+	return Amount(units), err
+}
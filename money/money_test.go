@@ -0,0 +1,196 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr error
+	}{
+		{input: "10.5", want: "10.50"},
+		{input: "-3", want: "-3.00"},
+		{input: " 1.25e3 ", want: "1250.00"},
+		{input: "0.01", want: "0.01"},
+		{input: "0", want: "0.00"},
+		{input: "92233720368547758.07", want: "92233720368547758.07"},
+		{input: "-92233720368547758.08", want: "-92233720368547758.08"},
+		// half to even
+		{input: "0.005", want: "0.00"},
+		{input: "0.015", want: "0.02"},
+		{input: "0.025", want: "0.02"},
+		{input: "0.0251", want: "0.03"},
+		{input: "-0.015", want: "-0.02"},
+		{input: "-0.025", want: "-0.02"},
+		{input: "2.675", want: "2.68"},
+		{input: "abc", wantErr: ErrInvalidAmount},
+		{input: "", wantErr: ErrInvalidAmount},
+		{input: "92233720368547758.08", wantErr: ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			amount, err := Parse(tt.input)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Parse(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.input, err)
+			}
+			if got := amount.String(); got != tt.want {
+				t.Fatalf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+
+			// what String prints parses back to the same amount
+			again, err := Parse(amount.String())
+			if err != nil || again != amount {
+				t.Fatalf("Parse(%q) = %d, %v, want %d", amount.String(), again, err, amount)
+			}
+		})
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	var got struct {
+		Number Amount `json:"number"`
+		Text   Amount `json:"text"`
+	}
+	if err := json.Unmarshal([]byte(`{"number": 10.005, "text": "0.1"}`), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Number != 1000 || got.Text != 10 {
+		t.Fatalf("unmarshal = %d, %d, want 1000, 10", got.Number, got.Text)
+	}
+
+	encoded, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != `{"number":10.00,"text":0.10}` {
+		t.Fatalf("marshal = %s", encoded)
+	}
+}
+
+func TestAmountScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Amount
+	}{
+		{src: nil, want: 0},
+		{src: int64(12), want: 1200},
+		{src: []byte("12.345"), want: 1234},
+		{src: "12.355", want: 1236},
+	}
+
+	for _, tt := range tests {
+		var amount Amount
+		if err := amount.Scan(tt.src); err != nil {
+			t.Fatalf("Scan(%v) error = %v", tt.src, err)
+		}
+		if amount != tt.want {
+			t.Fatalf("Scan(%v) = %d, want %d", tt.src, amount, tt.want)
+		}
+	}
+}
+
+func TestAddMulOverflow(t *testing.T) {
+	if _, err := Amount(math.MaxInt64).Add(1); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("Add error = %v, want ErrOverflow", err)
+	}
+	if _, err := Amount(math.MinInt64).Add(-1); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("Add error = %v, want ErrOverflow", err)
+	}
+	if _, err := Amount(math.MaxInt64 / 2).Mul(3); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("Mul error = %v, want ErrOverflow", err)
+	}
+	if _, err := Amount(math.MinInt64).Mul(-1); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("Mul error = %v, want ErrOverflow", err)
+	}
+
+	got, err := Amount(1999).Mul(3)
+	if err != nil || got != 5997 {
+		t.Fatalf("Mul = %d, %v, want 5997", got, err)
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	tests := []struct {
+		amount      Amount
+		numerator   int64
+		denominator int64
+		want        Amount
+	}{
+		{amount: 1000, numerator: 1, denominator: 3, want: 333},
+		{amount: 2000, numerator: 1, denominator: 3, want: 667},
+		{amount: 1050, numerator: 11, denominator: 100, want: 116}, // 115.5
+		{amount: 1250, numerator: 1, denominator: 100, want: 12},   // 12.5
+		{amount: 1350, numerator: 1, denominator: 100, want: 14},   // 13.5
+		{amount: -1250, numerator: 1, denominator: 100, want: -12},
+		{amount: 100000, numerator: 1100, denominator: 10000, want: 11000},
+		{amount: math.MaxInt64, numerator: 1, denominator: 1, want: math.MaxInt64},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d*%d/%d", tt.amount, tt.numerator, tt.denominator), func(t *testing.T) {
+			got, err := tt.amount.MulRatio(tt.numerator, tt.denominator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("MulRatio = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Amount(100).MulRatio(1, 0); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("MulRatio error = %v, want ErrInvalidAmount", err)
+	}
+	if _, err := Amount(math.MaxInt64).MulRatio(2, 1); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("MulRatio error = %v, want ErrOverflow", err)
+	}
+}
+
+// TestLargeCartNoDrift add up a large cart line by line and compare it with the exact rational total
+func TestLargeCartNoDrift(t *testing.T) {
+	const lines = 20000
+
+	var total Amount
+	exact := new(big.Rat)
+	seed := uint64(42)
+	for i := 0; i < lines; i++ {
+		// a small LCG keeps the cart the same on every run
+		seed = seed*6364136223846793005 + 1442695040888963407
+		price := fmt.Sprintf("%d.%02d", (seed>>33)%1000000, (seed>>20)%100)
+		quantity := int64((seed>>10)%500) + 1
+
+		amount, err := Parse(price)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line, err := amount.Mul(quantity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total, err = total.Add(line); err != nil {
+			t.Fatal(err)
+		}
+
+		rat, _ := new(big.Rat).SetString(price)
+		exact.Add(exact, rat.Mul(rat, new(big.Rat).SetInt64(quantity)))
+	}
+
+	if got, want := total.String(), exact.FloatString(Scale); got != want {
+		t.Fatalf("cart total = %s, exact total = %s", got, want)
+	}
+}
@@ -0,0 +1,117 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RateScale is the number of decimal places kept by a Rate
+const RateScale = 8
+
+const rateUnitsPerWhole = 100000000
+
+// Rate is an exchange rate with RateScale decimals, the amount of the quote currency bought by one
+// unit of the base currency. Like Amount it's an integer so a stored rate converts the same way every time.
+type Rate int64
+
+// IdentityRate convert a currency to itself
+const IdentityRate Rate = rateUnitsPerWhole
+
+// ParseRate read a decimal string such as "0.0000615" into a Rate, rounding half to even
+func ParseRate(value string) (Rate, error) {
+	rat, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok || rat.Sign() <= 0 {
+		return 0, fmt.Errorf("%w: exchange rate %q", ErrInvalidAmount, value)
+	}
+
+	units, err := scaleHalfEven(rat, rateUnitsPerWhole)
+	if err != nil {
+		return 0, err
+	}
+
+	if units == 0 {
+		return 0, fmt.Errorf("%w: exchange rate %q is below the rate precision", ErrInvalidAmount, value)
+	}
+	return Rate(units), nil
+}
+
+// Convert turn an amount of the base currency into the quote currency, rounding half to even
+func Convert(amount Amount, rate Rate) (Amount, error) {
+	rat := new(big.Rat).SetFrac(
+		new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(int64(rate))),
+		big.NewInt(rateUnitsPerWhole*unitsPerWhole),
+	)
+
+	units, err := scaleHalfEven(rat, unitsPerWhole)
+	return Amount(units), err
+}
+
+// String format the rate with exactly RateScale decimals
+func (r Rate) String() string {
+	sign := ""
+	units := uint64(r)
+	if r < 0 {
+		sign = "-"
+		units = uint64(-(r + 1)) + 1
+	}
+	return fmt.Sprintf("%s%d.%08d", sign, units/rateUnitsPerWhole, units%rateUnitsPerWhole)
+}
+
+// MarshalJSON encode the rate as a JSON number
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON accept a JSON number or a quoted decimal string
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if value == "null" {
+		return nil
+	}
+
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+
+	parsed, err := ParseRate(value)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Value store the rate as a decimal string so NUMERIC columns receive it exactly
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+// Scan read a NUMERIC column back into a Rate
+func (r *Rate) Scan(src interface{}) error {
+	var value string
+	switch v := src.(type) {
+	case nil:
+		*r = 0
+		return nil
+	case int64:
+		value = strconv.FormatInt(v, 10)
+	case float64:
+		value = strconv.FormatFloat(v, 'f', -1, 64)
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidAmount, src)
+	}
+
+	parsed, err := ParseRate(value)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
@@ -0,0 +1,76 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount string
+		rate   string
+		want   string
+	}{
+		{amount: "1000000", rate: "0.0000615", want: "61.50"},
+		{amount: "1", rate: "0.0000615", want: "0.00"},
+		{amount: "81300", rate: "0.0000615", want: "5.00"},  // 4.99995
+		{amount: "12345.67", rate: "1.5", want: "18518.50"}, // 18518.505, half to even
+		{amount: "12345.69", rate: "1.5", want: "18518.54"}, // 18518.535
+		{amount: "-12345.67", rate: "1.5", want: "-18518.50"},
+		{amount: "99.99", rate: "1", want: "99.99"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount+"x"+tt.rate, func(t *testing.T) {
+			amount, err := Parse(tt.amount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rate, err := ParseRate(tt.rate)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Convert(amount, rate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Fatalf("Convert = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got, _ := Convert(1234, IdentityRate); got != 1234 {
+		t.Fatalf("Convert with identity rate = %d, want 1234", got)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "0.0000615", want: "0.00006150"},
+		{input: "1", want: "1.00000000"},
+		{input: "0.000000005", wantErr: true}, // rounds to zero
+		{input: "0.000000015", want: "0.00000002"},
+		{input: "0", wantErr: true},
+		{input: "-1", wantErr: true},
+		{input: "x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.input)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Fatalf("ParseRate(%q) error = %v, want ErrInvalidAmount", tt.input, err)
+			}
+			continue
+		}
+		if err != nil || rate.String() != tt.want {
+			t.Fatalf("ParseRate(%q) = %s, %v, want %s", tt.input, rate, err, tt.want)
+		}
+	}
+}
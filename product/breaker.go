@@ -0,0 +1,87 @@
+package product
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stop calling the product service after threshold consecutive failures.
+// Once openTimeout elapsed a single trial call is let through: it closes the breaker when
+// it succeeds and opens it again when it fails.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	state       int
+	failures    int
+	threshold   int
+	openTimeout time.Duration
+	openedAt    time.Time
+	trialActive bool
+}
+
+func newCircuitBreaker(threshold int, openTimeout time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		state:       breakerClosed,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+	}
+}
+
+// allow report whether a call may go through
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.trialActive = true
+		return true
+	case breakerHalfOpen:
+		if b.trialActive {
+			return false
+		}
+		b.trialActive = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+	b.trialActive = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trialActive = false
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// cancel end a call whose outcome says nothing about the product service health,
+// such as a caller that gave up, without changing the breaker state
+func (b *circuitBreaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trialActive = false
+}
@@ -0,0 +1,178 @@
+package product
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"order_service/config"
+	"order_service/infra/log"
+	"order_service/models"
+	"time"
+)
+
+// Client call the product service. Every request has a timeout, GET requests are retried
+// with jittered exponential backoff, and a circuit breaker fails fast while the service is down.
+type Client struct {
+	host         string
+	httpClient   *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+	breaker      *circuitBreaker
+}
+
+func NewClient(cfg config.ProductService) *Client {
+	return &Client{
+		host: cfg.Host,
+		httpClient: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		maxRetries:   cfg.MaxRetries,
+		retryBackoff: cfg.RetryBackoff,
+		breaker:      newCircuitBreaker(cfg.BreakerFailureThreshold, cfg.BreakerOpenTimeout),
+	}
+}
+
+// GetProduct get product info, it returns ErrProductNotFound when the product doesn't exist
+func (c *Client) GetProduct(ctx context.Context, productId int64) (models.Product, error) {
+	url := fmt.Sprintf("%s/v1/product/%d", c.host, productId)
+
+	var response models.GetProductInfo
+	err := c.do(ctx, http.MethodGet, url, nil, &response, c.maxRetries)
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return models.Product{}, fmt.Errorf("%w: %d", ErrProductNotFound, productId)
+		}
+		return models.Product{}, err
+	}
+	return response.Product, nil
+}
+
+// Post send body as json to path. POST requests are not retried since they may not be idempotent.
+func (c *Client) Post(ctx context.Context, path string, body interface{}) error {
+	return c.do(ctx, http.MethodPost, c.host+path, body, nil, 0)
+}
+
+func (c *Client) do(ctx context.Context, method string, url string, body interface{}, out interface{}, retries int) error {
+	if !c.breaker.allow() {
+		return fmt.Errorf("%w: circuit breaker is open", ErrServiceUnavailable)
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			c.breaker.cancel()
+			return err
+		}
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retryable bool
+		retryable, err = c.attempt(ctx, method, url, payload, out)
+		if !retryable || attempt >= retries || ctx.Err() != nil {
+			break
+		}
+
+		wait := c.backoff(attempt)
+		log.Logger.WithFields(logrus.Fields{
+			"url":     url,
+			"attempt": attempt + 1,
+			"wait":    wait,
+			"err":     err.Error(),
+		}).Warn("Retrying product service request")
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+
+	switch {
+	case err == nil:
+		c.breaker.success()
+	case ctx.Err() != nil:
+		c.breaker.cancel()
+		return err
+	case errors.Is(err, ErrServiceUnavailable):
+		c.breaker.failure()
+	default:
+		// any other response still proves the service is up
+		c.breaker.success()
+	}
+	return err
+}
+
+// attempt send a single request. It reports whether the failure is worth retrying:
+// network errors, timeouts and 5xx are, everything else is not.
+func (c *Client) attempt(ctx context.Context, method string, url string, payload []byte, out interface{}) (bool, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return false, err
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"url": url,
+			"err": err.Error(),
+		}).Error("Failed to execute HTTP request")
+		return true, fmt.Errorf("%w: %s", ErrServiceUnavailable, err.Error())
+	}
+
+	defer func(Body io.ReadCloser) {
+		if err := Body.Close(); err != nil {
+			log.Logger.WithFields(logrus.Fields{
+				"url": url,
+				"err": err.Error(),
+			}).Error("Failed to close response body")
+		}
+	}(resp.Body)
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		log.Logger.WithFields(logrus.Fields{
+			"statusCode": resp.StatusCode,
+			"url":        url,
+		}).Error("Received 5xx HTTP status")
+		return true, fmt.Errorf("%w: %w", ErrServiceUnavailable, &StatusError{StatusCode: resp.StatusCode, URL: url})
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return false, &StatusError{StatusCode: resp.StatusCode, URL: url}
+	}
+
+	if out == nil {
+		return false, nil
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		log.Logger.WithFields(logrus.Fields{
+			"url": url,
+			"err": err.Error(),
+		}).Error("Failed to decode response body")
+		return false, err
+	}
+	return false, nil
+}
+
+// backoff double the wait on every attempt and spread it between 50% and 150% so
+// concurrent callers don't retry in lockstep
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.retryBackoff << attempt
+	return time.Duration(float64(wait) * (0.5 + rand.Float64()))
+}
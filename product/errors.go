@@ -0,0 +1,24 @@
+package product
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrProductNotFound is returned when the product service doesn't know the product
+	ErrProductNotFound = errors.New("product not found")
+	// ErrServiceUnavailable is returned when the product service can't be reached, keeps failing,
+	// or the circuit breaker is open
+	ErrServiceUnavailable = errors.New("product service unavailable")
+)
+
+// StatusError is returned for a response status the client doesn't have a dedicated error for
+type StatusError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("invalid response from %s, status code: %d", e.URL, e.StatusCode)
+}
@@ -0,0 +1,251 @@
+// Package producttest run an in-memory product service over httptest for tests. It serves the
+// product lookup and the stock reservation endpoints the order service calls.
+package producttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"order_service/config"
+	"order_service/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ReservationReserved  = "reserved"
+	ReservationConfirmed = "confirmed"
+	ReservationReleased  = "released"
+)
+
+// Reservation is the state the stub keeps for a reservation id
+type Reservation struct {
+	Items      map[int64]int64 // product id -> quantity still held
+	Status     string
+	TTLSeconds int64
+}
+
+// Server is a product service holding stock per product. Reserving takes stock, releasing gives
+// back what the reservation still holds, and confirming keeps it taken.
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	products     map[int64]models.Product
+	stock        map[int64]int64
+	reservations map[string]*Reservation
+	releases     map[string]bool
+	calls        []string
+
+	// ReserveFailure, when set, makes the next reservation be applied and then answered with
+	// this status, as a product service timing out after doing the work would
+	ReserveFailure int
+
+	// ReleaseItemsFailure, when set, makes the next partial release be answered with this status
+	// without applying it
+	ReleaseItemsFailure int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		products:     map[int64]models.Product{},
+		stock:        map[int64]int64{},
+		reservations: map[string]*Reservation{},
+		releases:     map[string]bool{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Config point a product client at the stub, without retries so every call is seen once
+func (s *Server) Config() config.ProductService {
+	return config.ProductService{
+		Host:                    s.URL,
+		Concurrency:             4,
+		CacheTTL:                time.Minute,
+		Timeout:                 5 * time.Second,
+		RetryBackoff:            time.Millisecond,
+		BreakerFailureThreshold: 100,
+		BreakerOpenTimeout:      time.Second,
+	}
+}
+
+// AddProduct register a product with stock units available
+func (s *Server) AddProduct(product models.Product, stock int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.products[product.ID] = product
+	s.stock[product.ID] = stock
+}
+
+// Stock get the units of a product that are not reserved
+func (s *Server) Stock(productID int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stock[productID]
+}
+
+// Reservation get a copy of a reservation, nil when the stub never saw it
+func (s *Server) Reservation(reservationID string) *Reservation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reservation, ok := s.reservations[reservationID]
+	if !ok {
+		return nil
+	}
+
+	copied := *reservation
+	copied.Items = make(map[int64]int64, len(reservation.Items))
+	for productID, qty := range reservation.Items {
+		copied.Items[productID] = qty
+	}
+	return &copied
+}
+
+// Calls list the requests received as "METHOD path", oldest first
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, r.Method+" "+r.URL.Path)
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/product/")
+	switch {
+	case r.Method == http.MethodGet:
+		s.getProduct(w, path)
+	case r.Method == http.MethodPost && path == "reservations":
+		s.reserve(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "reservations/"):
+		id, action, _ := strings.Cut(strings.TrimPrefix(path, "reservations/"), "/")
+		s.settle(w, r, id, action)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *Server) getProduct(w http.ResponseWriter, path string) {
+	productID, err := strconv.ParseInt(path, 10, 64)
+	product, ok := s.products[productID]
+	if err != nil || !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, models.GetProductInfo{Product: product})
+}
+
+func (s *Server) reserve(w http.ResponseWriter, r *http.Request) {
+	var request models.StockReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// the reservation id is an idempotency key
+	if _, ok := s.reservations[request.ReservationID]; ok {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	wanted := map[int64]int64{}
+	for _, item := range request.Items {
+		wanted[item.ProductID] += item.Quantity
+	}
+	for productID, qty := range wanted {
+		if s.stock[productID] < qty {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+	}
+
+	for productID, qty := range wanted {
+		s.stock[productID] -= qty
+	}
+	s.reservations[request.ReservationID] = &Reservation{
+		Items:      wanted,
+		Status:     ReservationReserved,
+		TTLSeconds: request.TTLSeconds,
+	}
+
+	if s.ReserveFailure != 0 {
+		status := s.ReserveFailure
+		s.ReserveFailure = 0
+		w.WriteHeader(status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) settle(w http.ResponseWriter, r *http.Request, reservationID string, action string) {
+	reservation, ok := s.reservations[reservationID]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "confirm":
+		if reservation.Status == ReservationReleased {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		reservation.Status = ReservationConfirmed
+
+	case "release":
+		if reservation.Status != ReservationReleased {
+			for productID, qty := range reservation.Items {
+				s.stock[productID] += qty
+				reservation.Items[productID] = 0
+			}
+			reservation.Status = ReservationReleased
+		}
+
+	case "release_items":
+		var request models.StockReleaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if s.releases[request.ReleaseID] {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if s.ReleaseItemsFailure != 0 {
+			status := s.ReleaseItemsFailure
+			s.ReleaseItemsFailure = 0
+			w.WriteHeader(status)
+			return
+		}
+		for _, item := range request.Items {
+			if reservation.Items[item.ProductID] < item.Quantity {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+
+		for _, item := range request.Items {
+			reservation.Items[item.ProductID] -= item.Quantity
+			s.stock[item.ProductID] += item.Quantity
+		}
+		s.releases[request.ReleaseID] = true
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
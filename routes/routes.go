@@ -3,13 +3,36 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	"order_service/cmd/handler"
+	"order_service/config"
+	"order_service/infra/constant"
 	"order_service/middleware"
 )
 
-func SetupRoutes(router *gin.Engine, orderHandler handler.OrderHandler, jwtSecret string) {
+func SetupRoutes(router *gin.Engine, orderHandler handler.OrderHandler, jwtSecret string, idempotencyStore middleware.IdempotencyStore, idempotencyConfig config.IdempotencyConfig) {
 	router.Use(middleware.RequestLogger())
 	authMiddleware := middleware.AuthMiddleware(jwtSecret)
 	router.Use(authMiddleware)
+	router.Use(middleware.IdempotencyMiddleware(idempotencyStore, idempotencyConfig.Retention, idempotencyConfig.LockTTL))
 	router.POST("/v1/checkout", orderHandler.CheckOutOrder)
+	router.GET("/v1/checkout/sagas/:id", orderHandler.GetCheckoutSaga)
 	router.GET("/v1/order_history", orderHandler.GetOrderHistory)
+	router.GET("/v1/orders/:id", orderHandler.GetOrderDetail)
+	router.POST("/v1/orders/:id/cancel", orderHandler.CancelOrder)
+	router.POST("/v1/orders/:id/items/cancel", middleware.RequireIdempotencyKey(), orderHandler.CancelOrderItems)
+	router.GET("/v1/payment_methods", orderHandler.GetPaymentMethods)
+	router.GET("/v1/addresses", orderHandler.GetAddresses)
+	router.POST("/v1/addresses", orderHandler.CreateAddress)
+	router.PUT("/v1/addresses/:id", orderHandler.UpdateAddress)
+	router.DELETE("/v1/addresses/:id", orderHandler.DeleteAddress)
+	router.POST("/v1/orders/:id/returns", orderHandler.RequestOrderReturn)
+	router.GET("/v1/orders/:id/returns", orderHandler.GetOrderReturns)
+
+	admin := router.Group("/v1/admin", middleware.RequireRole(constant.RoleAdmin))
+	admin.POST("/orders/:id/process", orderHandler.ProcessOrder)
+	admin.POST("/orders/:id/complete", orderHandler.CompleteOrder)
+	admin.POST("/orders/:id/fail", orderHandler.FailOrder)
+	admin.POST("/returns/:id/approve", orderHandler.ApproveOrderReturn)
+	admin.POST("/returns/:id/reject", orderHandler.RejectOrderReturn)
+	admin.POST("/returns/:id/receive", orderHandler.ReceiveOrderReturn)
+	admin.POST("/refunds/:id/retry", orderHandler.RetryOrderRefund)
 }